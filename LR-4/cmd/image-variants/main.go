@@ -0,0 +1,122 @@
+// Команда image-variants создает уменьшенные копии (srcset) для картинок,
+// загруженных в хранилище до появления копий, и пересоздает копии прежнего формата
+// в WebP. Новые загрузки получают копии сразу.
+//
+//	go run ./cmd/image-variants [-config config.yaml] [-force]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"path"
+
+	"smartdevices/internal/config"
+	"smartdevices/internal/images"
+	"smartdevices/internal/models"
+	"smartdevices/internal/storage"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func main() {
+	configPath := flag.String("config", "", "путь к файлу конфигурации (по умолчанию config.yaml или CONFIG_FILE)")
+	force := flag.Bool("force", false, "пересоздать копии и для картинок, у которых они уже есть")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal("Ошибка конфигурации:", err)
+	}
+
+	db, err := gorm.Open(postgres.Open(cfg.Database.DSN), &gorm.Config{})
+	if err != nil {
+		log.Fatal("Ошибка подключения к БД:", err)
+	}
+	if err := db.AutoMigrate(&models.ImageVariant{}); err != nil {
+		log.Fatal("Ошибка миграции схемы:", err)
+	}
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatal("Ошибка инициализации хранилища:", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		log.Fatal("Ошибка чтения списка объектов:", err)
+	}
+
+	// Уже известные оригиналы и их копии
+	var known []models.ImageVariant
+	if err := db.Find(&known).Error; err != nil {
+		log.Fatal("Ошибка чтения image_variants:", err)
+	}
+	originals := make(map[string]bool)
+	variants := make(map[string]bool)
+	outdated := make(map[string]bool) // копии в прежнем формате (JPEG/PNG вместо WebP)
+	for _, v := range known {
+		if v.Key == v.SourceKey {
+			originals[v.Key] = true
+		} else {
+			variants[v.Key] = true
+			if v.ContentType != images.WebP.ContentType {
+				outdated[v.SourceKey] = true
+			}
+		}
+	}
+
+	var created, skipped, failed int
+	for _, obj := range objects {
+		switch {
+		case variants[obj.Key]:
+			continue
+		case !isRaster(obj.Key):
+			skipped++
+			continue
+		case originals[obj.Key] && !outdated[obj.Key] && !*force:
+			skipped++
+			continue
+		}
+
+		rows, err := images.Generate(ctx, db, store, obj.Key)
+		if errors.Is(err, images.ErrUnsupported) {
+			log.Printf("⚠️ %s: %v", obj.Key, err)
+			skipped++
+			continue
+		}
+		if err != nil {
+			log.Printf("❌ %s: %v", obj.Key, err)
+			failed++
+			continue
+		}
+
+		// Копии этой картинки не должны попасть в обработку как оригиналы
+		for _, row := range rows {
+			if row.Key != obj.Key {
+				variants[row.Key] = true
+			}
+		}
+		fmt.Printf("✓ %s: %d копий\n", obj.Key, len(rows)-1)
+		created++
+	}
+
+	fmt.Printf("🖼️ Обработано: %d, пропущено: %d, ошибок: %d\n", created, skipped, failed)
+	if failed > 0 {
+		log.Fatal("Не для всех картинок удалось создать копии")
+	}
+}
+
+// isRaster - картинки, для которых создаются копии (SVG масштабируется без них)
+func isRaster(key string) bool {
+	switch path.Ext(key) {
+	case images.PNG.Ext, images.JPEG.Ext, ".jpeg", images.WebP.Ext:
+		return true
+	}
+	return false
+}
@@ -2,17 +2,36 @@ package main
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"time"
 
+	"smartdevices/internal/config"
+	"smartdevices/internal/devicefilter"
+	"smartdevices/internal/devicetype"
+	"smartdevices/internal/gallery"
+	"smartdevices/internal/models"
+	"smartdevices/internal/orderstate"
+	"smartdevices/internal/password"
+	"smartdevices/internal/storage"
+
 	_ "github.com/lib/pq"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
 )
 
 func main() {
+	configPath := flag.String("config", "", "путь к файлу конфигурации (по умолчанию config.yaml или CONFIG_FILE)")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal("Ошибка конфигурации:", err)
+	}
+
 	// Подключение к PostgreSQL
-	dsn := "host=localhost user=root password=root dbname=RIP port=5433 sslmode=disable"
-	db, err := sql.Open("postgres", dsn)
+	db, err := sql.Open("postgres", cfg.Database.DSN)
 	if err != nil {
 		log.Fatal("Ошибка подключения к БД:", err)
 	}
@@ -26,33 +45,67 @@ func main() {
 
 	fmt.Println("✅ Подключение к PostgreSQL установлено")
 
+	// Приводим схему в соответствие с моделями (новые таблицы и колонки)
+	fmt.Println("🏗️ Обновляем схему БД...")
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	if err != nil {
+		log.Fatal("Ошибка инициализации GORM:", err)
+	}
+	err = gormDB.AutoMigrate(&models.Client{}, &models.DeviceType{}, &models.SmartDevice{}, &models.SmartOrder{}, &models.OrderItem{}, &models.OrderEvent{}, &models.DeviceImage{}, &models.ImageVariant{})
+	if err != nil {
+		log.Fatal("Ошибка миграции схемы:", err)
+	}
+	if err := devicefilter.MigrateSearch(gormDB); err != nil {
+		log.Fatal("Ошибка создания полнотекстового индекса:", err)
+	}
+	if err := orderstate.MigrateDrafts(gormDB); err != nil {
+		log.Fatal("Ошибка создания индекса черновиков:", err)
+	}
+
+	// Типы устройств и классификация уже существующих устройств по названию
+	fmt.Println("🏷️ Классифицируем устройства по типам...")
+	if err := devicetype.Migrate(gormDB); err != nil {
+		log.Fatal("Ошибка миграции типов устройств:", err)
+	}
+
 	// Очищаем старые данные
 	fmt.Println("🧹 Очищаем старые данные...")
+	db.Exec("DELETE FROM order_events")
 	db.Exec("DELETE FROM order_items")
 	db.Exec("DELETE FROM smart_orders")
+	db.Exec("DELETE FROM device_images")
 	db.Exec("DELETE FROM smart_devices")
 	db.Exec("DELETE FROM clients")
 	db.Exec("ALTER SEQUENCE clients_id_seq RESTART WITH 1")
 	db.Exec("ALTER SEQUENCE smart_devices_id_seq RESTART WITH 1")
 	db.Exec("ALTER SEQUENCE smart_orders_id_seq RESTART WITH 1")
 
-	// 1. Клиенты
+	// 1. Клиенты (пароли хранятся в виде bcrypt-хэшей)
 	fmt.Println("👥 Добавляем клиентов...")
+	clientHash, err := password.Hash("pass123")
+	if err != nil {
+		log.Fatal("Ошибка хэширования пароля:", err)
+	}
+	moderatorHash, err := password.Hash("modpass123")
+	if err != nil {
+		log.Fatal("Ошибка хэширования пароля:", err)
+	}
+
 	var clientID, moderatorID int
 	err = db.QueryRow(`
         INSERT INTO clients (username, password, is_moderator, date_joined)
-        VALUES ('client1', 'pass123', FALSE, $1)
+        VALUES ('client1', $1, FALSE, $2)
         RETURNING id
-    `, time.Now()).Scan(&clientID)
+    `, clientHash, time.Now()).Scan(&clientID)
 	if err != nil {
 		log.Printf("Ошибка добавления client1: %v", err)
 	}
 
 	err = db.QueryRow(`
         INSERT INTO clients (username, password, is_moderator, date_joined)
-        VALUES ('moderator1', 'modpass123', TRUE, $1)
+        VALUES ('moderator1', $1, TRUE, $2)
         RETURNING id
-    `, time.Now()).Scan(&moderatorID)
+    `, moderatorHash, time.Now()).Scan(&moderatorID)
 	if err != nil {
 		log.Printf("Ошибка добавления moderator1: %v", err)
 	}
@@ -60,44 +113,51 @@ func main() {
 	fmt.Printf("✓ Создан клиент client1 с ID: %d\n", clientID)
 	fmt.Printf("✓ Создан пользователь moderator1 с ID: %d\n", moderatorID)
 
-	// 2. Умные устройства
+	// 2. Умные устройства (URL картинок - в выбранном объектном хранилище)
 	fmt.Println("💡 Добавляем умные устройства...")
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatal("Ошибка инициализации хранилища:", err)
+	}
+	defer store.Close()
+
 	devices := []struct {
 		name        string
 		model       string
 		dataRate    float64
 		dataPerHour float64
 		imageFile   string // имя файла картинки
+		typeCode    string // код типа устройства
 		description string
 		fullDesc    string
 		protocol    string
 	}{
 		{
-			"Хаб", "Яндекс Хаб", 5120, 56.25, "hub.png",
+			"Хаб", "Яндекс Хаб", 5120, 56.25, "hub.png", "hub",
 			"Умный пульт Яндекс Хаб для устройств",
 			"Умный пульт Яндекс Хаб для управления всеми устройствами умного дома. Центральное устройство системы, координирующее работу всех подключенных девайсов.",
 			"Wi-Fi",
 		},
 		{
-			"Лампочка", "Яндекс, E27", 8, 0.5, "lamp.png",
+			"Лампочка", "Яндекс, E27", 8, 0.5, "lamp.png", "bulb",
 			"Умная лампочка Яндекс, E27",
 			"Умная Яндекс лампочка позволяет дистанционно управлять освещением в комнате или доме. Поддержка Wi-Fi позволяет лампе работать в Умном доме Яндекса и реагировать на команды, отданные по мобильному приложению или напрямую голосовому помощнику Алисе.",
 			"Wi-Fi",
 		},
 		{
-			"Розетка", "YNDX-00340", 2, 0.1, "socket.png",
+			"Розетка", "YNDX-00340", 2, 0.1, "socket.png", "socket",
 			"Умная розетка Яндекс YNDX-00340",
 			"Умная розетка для дистанционного управления электроприборами. Позволяет включать и выключать устройства по расписанию или голосовой команде.",
 			"Wi-Fi",
 		},
 		{
-			"Датчик", "Aqara Motion Sensor P1", 5, 0.3, "sensor.png",
+			"Датчик", "Aqara Motion Sensor P1", 5, 0.3, "sensor.png", "sensor",
 			"Датчик движения Aqara Motion Sensor P1",
 			"Беспроводной датчик движения для автоматизации освещения и безопасности. Реагирует на движение в помещении и отправляет уведомления.",
 			"Zigbee",
 		},
 		{
-			"Выключатель", "Яндекс, 2 клавиши", 3, 0.2, "switch.png",
+			"Выключатель", "Яндекс, 2 клавиши", 3, 0.2, "switch.png", "switch",
 			"Умный беспроводной выключатель Яндекс, 2 клавиши",
 			"Беспроводной выключатель для управления умным освещением. Не требует прокладки проводов, работает от батареек.",
 			"Bluetooth",
@@ -105,13 +165,12 @@ func main() {
 	}
 
 	for _, d := range devices {
-		// Генерируем MinIO URL для картинки
-		namespaceURL := fmt.Sprintf("http://localhost:9000/image/%s", d.imageFile)
+		namespaceURL := store.URL(d.imageFile)
 
 		_, err := db.Exec(`
-            INSERT INTO smart_devices (name, model, avg_data_rate, data_per_hour, namespace_url, description, description_all, protocol, created_at)
-            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-        `, d.name, d.model, d.dataRate, d.dataPerHour, namespaceURL, d.description, d.fullDesc, d.protocol, time.Now())
+            INSERT INTO smart_devices (name, model, avg_data_rate, data_per_hour, namespace_url, description, description_all, protocol, created_at, device_type_id)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, (SELECT id FROM device_types WHERE code = $10))
+        `, d.name, d.model, d.dataRate, d.dataPerHour, namespaceURL, d.description, d.fullDesc, d.protocol, time.Now(), d.typeCode)
 
 		if err != nil {
 			log.Printf("Ошибка добавления %s: %v", d.name, err)
@@ -120,6 +179,11 @@ func main() {
 		}
 	}
 
+	// Картинка каждого устройства - главная в его галерее
+	if err := gallery.Migrate(gormDB, store); err != nil {
+		log.Fatal("Ошибка создания галерей устройств:", err)
+	}
+
 	// 3. Демо-заявка (используем реальный clientID)
 	fmt.Println("📋 Создаем демо-заявку...")
 	var orderID int
@@ -161,5 +225,5 @@ func main() {
 	fmt.Println("✅ Миграция завершена успешно!")
 	fmt.Printf("👤 Демо-клиент: client1 (ID: %d) / pass123\n", clientID)
 	fmt.Printf("🛒 Демо-заявка создана с 2 устройствами\n")
-	fmt.Println("🖼️ Картинки загружены с MinIO URL")
+	fmt.Printf("🖼️ Картинки ссылаются на хранилище: %s\n", cfg.Storage.Backend)
 }
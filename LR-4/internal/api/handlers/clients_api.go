@@ -2,13 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
-	"strings"
 
 	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/apperr"
 	"smartdevices/internal/middleware"
 	"smartdevices/internal/models"
+	"smartdevices/internal/pagination"
+	"smartdevices/internal/password"
+	"smartdevices/internal/router"
+	"smartdevices/internal/validate"
 
 	"gorm.io/gorm"
 )
@@ -18,28 +22,34 @@ type ClientAPIHandler struct {
 	authMiddleware *middleware.AuthMiddleware
 }
 
-func NewClientAPIHandler(db *gorm.DB) *ClientAPIHandler {
+func NewClientAPIHandler(db *gorm.DB, authMiddleware *middleware.AuthMiddleware) *ClientAPIHandler {
 	return &ClientAPIHandler{
 		db:             db,
-		authMiddleware: middleware.NewAuthMiddleware(db),
+		authMiddleware: authMiddleware,
 	}
 }
 
+// clientPages - допустимые поля сортировки списка клиентов
+var clientPages = pagination.Spec[models.Client]{
+	Fields: map[string]pagination.Field[models.Client]{
+		"id":          {Column: "id", Value: func(c models.Client) any { return c.ID }},
+		"username":    {Column: "username", Value: func(c models.Client) any { return c.Username }},
+		"date_joined": {Column: "date_joined", Value: func(c models.Client) any { return c.DateJoined }},
+	},
+	Default: "id",
+}
+
 // GET /api/clients - список клиентов
 func (h *ClientAPIHandler) GetClients(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	pageParams, err := pagination.Parse(r, clientPages)
+	if err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
-	var clients []models.Client
-	result := h.db.Find(&clients)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	clients, page, err := pagination.Query(h.db, pageParams)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
 		return
 	}
 
@@ -48,32 +58,23 @@ func (h *ClientAPIHandler) GetClients(w http.ResponseWriter, r *http.Request) {
 		response = append(response, serializers.ClientToJSON(client))
 	}
 
+	pagination.WriteHeaders(w, r, page)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
 // GET /api/clients/{id} - один клиент
 func (h *ClientAPIHandler) GetClient(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/clients/")
-	id, err := strconv.Atoi(idStr)
+	id, err := router.UintParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid client ID", http.StatusBadRequest)
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
 		return
 	}
 
 	var client models.Client
 	result := h.db.First(&client, id)
 	if result.Error != nil {
-		http.Error(w, "Client not found", http.StatusNotFound)
+		apperr.Write(w, r, apperr.NotFound("Client not found"))
 		return
 	}
 
@@ -83,35 +84,31 @@ func (h *ClientAPIHandler) GetClient(w http.ResponseWriter, r *http.Request) {
 
 // POST /api/clients/register - создание клиента
 func (h *ClientAPIHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	var req serializers.ClientRegisterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
-	if req.Username == "" || req.Password == "" {
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+	hash, err := password.Hash(req.Password)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
 		return
 	}
 
 	client := models.Client{
 		Username: req.Username,
-		Password: req.Password,
+		Password: hash,
 		IsActive: true,
 	}
 
 	result := h.db.Create(&client)
+	if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+		apperr.Write(w, r, apperr.Conflict("Username is already taken"))
+		return
+	}
 	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		apperr.Write(w, r, apperr.Internal(result.Error))
 		return
 	}
 
@@ -122,118 +119,158 @@ func (h *ClientAPIHandler) CreateClient(w http.ResponseWriter, r *http.Request)
 
 // PUT /api/clients/update - изменение клиента
 func (h *ClientAPIHandler) UpdateClient(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	// Получаем текущего пользователя
 	currentUser := h.authMiddleware.GetCurrentUser(r)
 	if currentUser == nil {
-		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
 		return
 	}
 
 	var req struct {
-		ID       uint   `json:"id"`
-		Username string `json:"username"`
-		Password string `json:"password"`
+		ID          uint   `json:"id" validate:"required"`
+		Username    string `json:"username" validate:"required,min=3,max=150"`
+		Password    string `json:"password" validate:"omitempty,min=6,maxbytes=72"`
+		IsModerator *bool  `json:"is_moderator"`
+		IsActive    *bool  `json:"is_active"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
 	// Проверяем что пользователь обновляет свои данные
 	if currentUser.ClientID != req.ID && !currentUser.IsModerator {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		apperr.Write(w, r, apperr.Forbidden("Access denied"))
 		return
 	}
 
 	var client models.Client
 	result := h.db.First(&client, req.ID)
 	if result.Error != nil {
-		http.Error(w, "Client not found", http.StatusNotFound)
+		apperr.Write(w, r, apperr.NotFound("Client not found"))
 		return
 	}
 
 	client.Username = req.Username
 	if req.Password != "" {
-		client.Password = req.Password
+		hash, err := password.Hash(req.Password)
+		if err != nil {
+			apperr.Write(w, r, apperr.Internal(err))
+			return
+		}
+		client.Password = hash
+	}
+
+	// Права меняет только модератор
+	privilegesChanged := false
+	if req.IsModerator != nil && *req.IsModerator != client.IsModerator {
+		if !currentUser.IsModerator {
+			apperr.Write(w, r, apperr.Forbidden("Access denied"))
+			return
+		}
+		client.IsModerator = *req.IsModerator
+		privilegesChanged = true
+	}
+
+	// Блокирует и разблокирует клиентов только модератор
+	deactivated := false
+	if req.IsActive != nil && *req.IsActive != client.IsActive {
+		if !currentUser.IsModerator {
+			apperr.Write(w, r, apperr.Forbidden("Access denied"))
+			return
+		}
+		client.IsActive = *req.IsActive
+		deactivated = !client.IsActive
+	}
+
+	if err := h.db.Save(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			apperr.Write(w, r, apperr.Conflict("Username is already taken"))
+			return
+		}
+		apperr.Write(w, r, apperr.Internal(err))
+		return
 	}
 
-	h.db.Save(&client)
+	// Заблокированный клиент разлогинивается на всех устройствах
+	if deactivated {
+		if _, err := h.authMiddleware.RevokeClientSessions(client.ID); err != nil {
+			apperr.Write(w, r, apperr.Internal(err))
+			return
+		}
+	}
+
+	// После изменения прав старые сессии недействительны
+	if privilegesChanged && !deactivated {
+		if err := h.authMiddleware.ClientPrivilegesChanged(w, r, client); err != nil {
+			apperr.Write(w, r, apperr.Internal(err))
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(serializers.ClientToJSON(client))
 }
 
-// POST /api/clients/login - аутентификация
-func (h *ClientAPIHandler) Login(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// DELETE /api/clients/{id}/sessions - принудительный выход клиента
+func (h *ClientAPIHandler) ForceLogoutClient(w http.ResponseWriter, r *http.Request) {
+	id, err := router.UintParam(r, "id")
+	if err != nil {
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
+		return
+	}
 
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	var client models.Client
+	result := h.db.First(&client, id)
+	if result.Error != nil {
+		apperr.Write(w, r, apperr.NotFound("Client not found"))
 		return
 	}
 
-	var req serializers.ClientLoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	revoked, err := h.authMiddleware.RevokeClientSessions(client.ID)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
 		return
 	}
 
-	var client models.Client
-	result := h.db.Where("username = ? AND password = ? AND is_active = ?", req.Username, req.Password, true).First(&client)
-	if result.Error != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"revoked": revoked,
+	})
+}
+
+// POST /api/clients/login - аутентификация
+func (h *ClientAPIHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req serializers.ClientLoginRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
-	// Создаем сессию через middleware
-	sessionID, err := h.authMiddleware.CreateSession(client)
+	client, err := h.authMiddleware.Authenticate(req.Username, req.Password)
 	if err != nil {
-		http.Error(w, "Session creation failed", http.StatusInternalServerError)
+		apperr.Write(w, r, apperr.InvalidCredentials())
 		return
 	}
 
-	// Устанавливаем куки
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    sessionID,
-		Path:     "/",
-		MaxAge:   86400, // 24 часа
-		HttpOnly: true,
-		Secure:   false, // true в production
-		SameSite: http.SameSiteLaxMode,
-	})
+	// Создаем сессию и куку через middleware
+	if err := h.authMiddleware.StartSession(w, r, *client); err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
-		"user":    serializers.ClientToJSON(client),
+		"user":    serializers.ClientToJSON(*client),
 		"message": "Login successful",
 	})
 }
 
 // POST /api/clients/logout - деавторизация
 func (h *ClientAPIHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	cookie, err := r.Cookie("session_id")
 	if err == nil {
 		h.authMiddleware.DeleteSession(cookie.Value)
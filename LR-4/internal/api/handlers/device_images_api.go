@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/apperr"
+	"smartdevices/internal/gallery"
+	"smartdevices/internal/images"
+	"smartdevices/internal/models"
+	"smartdevices/internal/router"
+	"smartdevices/internal/validate"
+
+	"gorm.io/gorm"
+)
+
+// Галерея устройства: файлы - в хранилище, порядок, подписи и главная картинка -
+// в device_images. URL главной картинки дублируется в SmartDevice.NamespaceURL.
+
+// GET /api/smart-devices/{id}/images - картинки устройства по порядку
+func (h *SmartDeviceAPIHandler) GetDeviceImages(w http.ResponseWriter, r *http.Request) {
+	device, err := h.galleryDevice(r)
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+	h.writeGallery(w, r, device.ID)
+}
+
+// POST /api/smart-devices/{id}/images - добавление картинки в конец галереи.
+// multipart: image - файл, alt_text - подпись, primary=true - сделать главной.
+func (h *SmartDeviceAPIHandler) AddDeviceImage(w http.ResponseWriter, r *http.Request) {
+	device, err := h.galleryDevice(r)
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	form, _, key, err := h.receiveImage(w, r, device.ID)
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	image, err := gallery.Add(r.Context(), h.db, h.storage, device.ID, key, form.AltText, form.Primary)
+	if err != nil {
+		apperr.Write(w, r, galleryError(err))
+		return
+	}
+
+	sets, err := h.gallerySets([]models.DeviceImage{image})
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializers.DeviceImageToJSON(image, sets[image.URL]))
+}
+
+// PUT /api/smart-devices/{id}/images/order - новый порядок галереи
+func (h *SmartDeviceAPIHandler) ReorderDeviceImages(w http.ResponseWriter, r *http.Request) {
+	device, err := h.galleryDevice(r)
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	var req serializers.DeviceImageOrderRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	if err := gallery.Reorder(h.db, device.ID, req.ImageIDs); err != nil {
+		apperr.Write(w, r, galleryError(err))
+		return
+	}
+	h.writeGallery(w, r, device.ID)
+}
+
+// PUT /api/smart-devices/{id}/images/{imageId} - изменение подписи
+func (h *SmartDeviceAPIHandler) UpdateDeviceImage(w http.ResponseWriter, r *http.Request) {
+	image, err := h.galleryImage(r)
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	var req serializers.DeviceImageUpdateRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	if err := gallery.UpdateAltText(h.db, &image, req.AltText); err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	sets, err := h.gallerySets([]models.DeviceImage{image})
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.DeviceImageToJSON(image, sets[image.URL]))
+}
+
+// PUT /api/smart-devices/{id}/images/{imageId}/primary - сделать картинку главной
+func (h *SmartDeviceAPIHandler) SetPrimaryDeviceImage(w http.ResponseWriter, r *http.Request) {
+	image, err := h.galleryImage(r)
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	if err := gallery.SetPrimary(h.db, image); err != nil {
+		apperr.Write(w, r, galleryError(err))
+		return
+	}
+	h.writeGallery(w, r, image.DeviceID)
+}
+
+// DELETE /api/smart-devices/{id}/images/{imageId} - удаление картинки из галереи и хранилища
+func (h *SmartDeviceAPIHandler) DeleteGalleryImage(w http.ResponseWriter, r *http.Request) {
+	image, err := h.galleryImage(r)
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	if err := gallery.Delete(r.Context(), h.db, h.storage, image); err != nil {
+		apperr.Write(w, r, galleryError(err))
+		return
+	}
+
+	fmt.Printf("✅ Gallery image deleted: %s (device %d)\n", image.Key, image.DeviceID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// galleryDevice загружает устройство из пути запроса
+func (h *SmartDeviceAPIHandler) galleryDevice(r *http.Request) (models.SmartDevice, error) {
+	id, err := router.UintParam(r, "id")
+	if err != nil {
+		return models.SmartDevice{}, apperr.InvalidParam("id", err)
+	}
+
+	var device models.SmartDevice
+	if err := h.db.First(&device, id).Error; err != nil {
+		return models.SmartDevice{}, apperr.NotFound("Device not found")
+	}
+	return device, nil
+}
+
+// galleryImage загружает картинку из пути запроса; картинка другого устройства - 404
+func (h *SmartDeviceAPIHandler) galleryImage(r *http.Request) (models.DeviceImage, error) {
+	id, err := router.UintParam(r, "id")
+	if err != nil {
+		return models.DeviceImage{}, apperr.InvalidParam("id", err)
+	}
+	imageID, err := router.UintParam(r, "imageId")
+	if err != nil {
+		return models.DeviceImage{}, apperr.InvalidParam("imageId", err)
+	}
+
+	image, err := gallery.Find(h.db, id, imageID)
+	if err != nil {
+		return models.DeviceImage{}, galleryError(err)
+	}
+	return image, nil
+}
+
+func (h *SmartDeviceAPIHandler) writeGallery(w http.ResponseWriter, r *http.Request, deviceID uint) {
+	list, err := gallery.List(h.db, deviceID)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+	sets, err := h.gallerySets(list)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	response := galleryToJSON(list, sets)
+	if response == nil {
+		response = []serializers.DeviceImageResponse{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// gallerySets загружает размеры картинок галереи для srcset, по URL
+func (h *SmartDeviceAPIHandler) gallerySets(list []models.DeviceImage) (map[string]images.Set, error) {
+	urls := make([]string, len(list))
+	for i, image := range list {
+		urls[i] = image.URL
+	}
+	return images.LoadSets(h.db, h.storage, urls)
+}
+
+func galleryToJSON(list []models.DeviceImage, sets map[string]images.Set) []serializers.DeviceImageResponse {
+	var response []serializers.DeviceImageResponse
+	for _, image := range list {
+		response = append(response, serializers.DeviceImageToJSON(image, sets[image.URL]))
+	}
+	return response
+}
+
+// galleryError переводит ошибки галереи в ответ API
+func galleryError(err error) error {
+	switch {
+	case errors.Is(err, gallery.ErrTooMany):
+		return apperr.Conflict(fmt.Sprintf("Device can have at most %d images", gallery.MaxImages))
+	case errors.Is(err, gallery.ErrOrder):
+		return apperr.Validation(apperr.FieldError{Field: "image_ids", Code: "order", Message: err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return apperr.NotFound("Image not found")
+	default:
+		return apperr.Internal(err)
+	}
+}
+
+// imageFields - текстовые поля формы загрузки
+type imageFields struct {
+	serializers.DeviceImageFields
+	Primary bool
+}
+
+// receiveImage читает из multipart-формы файл image, проверяет его и сохраняет
+// в хранилище потоком. Текстовые поля формы могут идти как до файла, так и после.
+func (h *SmartDeviceAPIHandler) receiveImage(w http.ResponseWriter, r *http.Request, deviceID uint) (imageFields, *images.Image, string, error) {
+	// Читаем multipart потоком: файл не буферизуется целиком ни в памяти, ни на диске
+	r.Body = http.MaxBytesReader(w, r.Body, h.imageLimits.MaxBytes+multipartOverhead)
+	form, err := readImageForm(r)
+	if err != nil {
+		return imageFields{}, nil, "", err
+	}
+	defer form.image.Close()
+
+	// Формат определяем по содержимому, имя файла и заявленный клиентом тип не учитываются
+	img, err := images.Open(form.image, h.imageLimits)
+	if err != nil {
+		return imageFields{}, nil, "", imageError(err)
+	}
+
+	key, err := h.putImage(r.Context(), deviceID, img)
+	if err != nil {
+		return imageFields{}, nil, "", err
+	}
+
+	fields, err := form.fields()
+	if err != nil {
+		h.deleteUploaded(r.Context(), key)
+		return imageFields{}, nil, "", err
+	}
+	return fields, img, key, nil
+}
+
+// putImage сохраняет проверенную картинку под новым ключом на латинице
+func (h *SmartDeviceAPIHandler) putImage(ctx context.Context, deviceID uint, img *images.Image) (string, error) {
+	key := fmt.Sprintf("device_%d_%d%s", deviceID, time.Now().UnixNano(), img.Format.Ext)
+
+	err := h.storage.Put(ctx, key, img, img.Size, img.Format.ContentType)
+	if tooLarge := img.Err(); tooLarge != nil {
+		return "", imageError(tooLarge)
+	}
+	if err != nil {
+		fmt.Printf("❌ Storage upload failed: %v\n", err)
+		var maxBytes *http.MaxBytesError
+		if errors.As(err, &maxBytes) {
+			return "", imageError(err)
+		}
+		return "", apperr.Internal(err)
+	}
+
+	fmt.Printf("✅ Image uploaded: %s (%s, %dx%d, %d bytes)\n", key, img.Format.ContentType, img.Width, img.Height, img.BytesRead())
+	return key, nil
+}
+
+// deleteUploaded удаляет сохраненный файл, если загрузку не удалось завершить
+func (h *SmartDeviceAPIHandler) deleteUploaded(ctx context.Context, key string) {
+	if err := h.storage.Delete(ctx, key); err != nil {
+		fmt.Printf("⚠️ Failed to delete uploaded image %s: %v\n", key, err)
+	}
+}
+
+// multipartOverhead - запас на заголовки частей и другие поля формы сверх размера файла
+const multipartOverhead = 64 << 10
+
+// maxFormValue - предельная длина текстового поля формы загрузки
+const maxFormValue = 4 << 10
+
+// imageForm - multipart-форма с файлом image. Поля до файла читаются сразу,
+// после файла - в fields, когда файл уже сохранен.
+type imageForm struct {
+	reader *multipart.Reader
+	image  *multipart.Part
+	values map[string]string
+}
+
+func readImageForm(r *http.Request) (*imageForm, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, apperr.BadRequest("Failed to parse multipart form").Wrap(err)
+	}
+
+	form := &imageForm{reader: mr, values: map[string]string{}}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, apperr.Validation(apperr.FieldError{Field: "image", Code: "required", Message: "Image file is required"})
+		}
+		if err != nil {
+			return nil, imageError(err)
+		}
+		if part.FormName() == "image" && part.FileName() != "" {
+			form.image = part
+			return form, nil
+		}
+		if err := form.readValue(part); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fields дочитывает форму после файла и проверяет текстовые поля
+func (f *imageForm) fields() (imageFields, error) {
+	for {
+		part, err := f.reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return imageFields{}, imageError(err)
+		}
+		if err := f.readValue(part); err != nil {
+			return imageFields{}, err
+		}
+	}
+
+	fields := imageFields{DeviceImageFields: serializers.DeviceImageFields{AltText: f.values["alt_text"]}}
+	if errs := validate.Struct(&fields.DeviceImageFields); len(errs) > 0 {
+		return imageFields{}, apperr.Validation(errs...)
+	}
+	if v, ok := f.values["primary"]; ok {
+		primary, err := strconv.ParseBool(v)
+		if err != nil {
+			return imageFields{}, apperr.Validation(apperr.FieldError{Field: "primary", Code: "invalid", Message: "primary must be true or false"})
+		}
+		fields.Primary = primary
+	}
+	return fields, nil
+}
+
+// readValue запоминает значение текстового поля; другие файлы пропускаются
+func (f *imageForm) readValue(part *multipart.Part) error {
+	defer part.Close()
+	if part.FileName() != "" {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(part, maxFormValue+1))
+	if err != nil {
+		return imageError(err)
+	}
+	if len(data) > maxFormValue {
+		return apperr.Validation(apperr.FieldError{Field: part.FormName(), Code: "max",
+			Message: fmt.Sprintf("%s must contain at most %d bytes", part.FormName(), maxFormValue)})
+	}
+	f.values[part.FormName()] = string(data)
+	return nil
+}
+
+// imageError переводит ошибки проверки и чтения картинки в ответ API
+func imageError(err error) error {
+	var maxBytes *http.MaxBytesError
+	switch {
+	case errors.Is(err, images.ErrTooLarge), errors.As(err, &maxBytes):
+		return apperr.New(http.StatusRequestEntityTooLarge, validate.CodeBodyTooLarge, "Image file is too large").Wrap(err)
+	case errors.Is(err, images.ErrUnsupported):
+		return apperr.New(http.StatusUnsupportedMediaType, apperr.CodeUnsupportedMedia,
+			"Image must be PNG, JPEG, WebP or SVG").Wrap(err)
+	case errors.Is(err, images.ErrDimensions):
+		return apperr.Validation(apperr.FieldError{Field: "image", Code: "dimensions", Message: err.Error()})
+	default:
+		return apperr.BadRequest("Failed to read image file").Wrap(err)
+	}
+}
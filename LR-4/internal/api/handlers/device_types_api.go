@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/apperr"
+	"smartdevices/internal/middleware"
+	"smartdevices/internal/models"
+	"smartdevices/internal/router"
+	"smartdevices/internal/validate"
+
+	"gorm.io/gorm"
+)
+
+type DeviceTypeAPIHandler struct {
+	db             *gorm.DB
+	authMiddleware *middleware.AuthMiddleware
+}
+
+func NewDeviceTypeAPIHandler(db *gorm.DB, authMiddleware *middleware.AuthMiddleware) *DeviceTypeAPIHandler {
+	return &DeviceTypeAPIHandler{
+		db:             db,
+		authMiddleware: authMiddleware,
+	}
+}
+
+// GET /api/device-types - все типы устройств (справочник небольшой, без пагинации)
+func (h *DeviceTypeAPIHandler) GetDeviceTypes(w http.ResponseWriter, r *http.Request) {
+	var deviceTypes []models.DeviceType
+	if err := h.db.Order("name").Find(&deviceTypes).Error; err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	response := []serializers.DeviceTypeResponse{}
+	for _, deviceType := range deviceTypes {
+		response = append(response, serializers.DeviceTypeToJSON(deviceType))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GET /api/device-types/{id} - один тип
+func (h *DeviceTypeAPIHandler) GetDeviceType(w http.ResponseWriter, r *http.Request) {
+	id, err := router.UintParam(r, "id")
+	if err != nil {
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
+		return
+	}
+
+	var deviceType models.DeviceType
+	if err := h.db.First(&deviceType, id).Error; err != nil {
+		apperr.Write(w, r, apperr.NotFound("Device type not found"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.DeviceTypeToJSON(deviceType))
+}
+
+// POST /api/device-types - добавление типа
+func (h *DeviceTypeAPIHandler) CreateDeviceType(w http.ResponseWriter, r *http.Request) {
+	var req serializers.DeviceTypeRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	if err := h.checkCodeFree(req.Code, 0); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	deviceType := models.DeviceType{
+		Code:               req.Code,
+		Name:               req.Name,
+		TrafficCoefficient: req.TrafficCoefficient,
+	}
+	if err := h.db.Create(&deviceType).Error; err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializers.DeviceTypeToJSON(deviceType))
+}
+
+// PUT /api/device-types/{id} - изменение типа. Новый коэффициент действует для
+// еще не завершенных заявок, у завершенных трафик уже сохранен.
+func (h *DeviceTypeAPIHandler) UpdateDeviceType(w http.ResponseWriter, r *http.Request) {
+	id, err := router.UintParam(r, "id")
+	if err != nil {
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
+		return
+	}
+
+	var deviceType models.DeviceType
+	if err := h.db.First(&deviceType, id).Error; err != nil {
+		apperr.Write(w, r, apperr.NotFound("Device type not found"))
+		return
+	}
+
+	var req serializers.DeviceTypeRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	if err := h.checkCodeFree(req.Code, deviceType.ID); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	deviceType.Code = req.Code
+	deviceType.Name = req.Name
+	deviceType.TrafficCoefficient = req.TrafficCoefficient
+	if err := h.db.Save(&deviceType).Error; err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.DeviceTypeToJSON(deviceType))
+}
+
+// DELETE /api/device-types/{id} - удаление типа, если он не назначен ни одному устройству
+func (h *DeviceTypeAPIHandler) DeleteDeviceType(w http.ResponseWriter, r *http.Request) {
+	id, err := router.UintParam(r, "id")
+	if err != nil {
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
+		return
+	}
+
+	var deviceType models.DeviceType
+	if err := h.db.First(&deviceType, id).Error; err != nil {
+		apperr.Write(w, r, apperr.NotFound("Device type not found"))
+		return
+	}
+
+	var inUse int64
+	if err := h.db.Model(&models.SmartDevice{}).Where("device_type_id = ?", deviceType.ID).Count(&inUse).Error; err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+	if inUse > 0 {
+		apperr.Write(w, r, apperr.Conflict("Device type is assigned to devices"))
+		return
+	}
+
+	if err := h.db.Delete(&deviceType).Error; err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkCodeFree проверяет, что код не занят другим типом
+func (h *DeviceTypeAPIHandler) checkCodeFree(code string, exceptID uint) error {
+	var count int64
+	err := h.db.Model(&models.DeviceType{}).Where("code = ? AND id <> ?", code, exceptID).Count(&count).Error
+	if err != nil {
+		return apperr.Internal(err)
+	}
+	if count > 0 {
+		return apperr.Conflict("Device type with this code already exists")
+	}
+	return nil
+}
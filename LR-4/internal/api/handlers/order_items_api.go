@@ -2,14 +2,19 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"strconv"
 
+	"smartdevices/internal/apperr"
 	"smartdevices/internal/middleware"
 	"smartdevices/internal/models"
+	"smartdevices/internal/orderstate"
+	"smartdevices/internal/router"
+	"smartdevices/internal/validate"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderItemAPIHandler struct {
@@ -17,71 +22,61 @@ type OrderItemAPIHandler struct {
 	authMiddleware *middleware.AuthMiddleware
 }
 
-func NewOrderItemAPIHandler(db *gorm.DB) *OrderItemAPIHandler {
+func NewOrderItemAPIHandler(db *gorm.DB, authMiddleware *middleware.AuthMiddleware) *OrderItemAPIHandler {
 	return &OrderItemAPIHandler{
 		db:             db,
-		authMiddleware: middleware.NewAuthMiddleware(db),
+		authMiddleware: authMiddleware,
 	}
 }
 
 // PUT /api/order-items/{deviceId} - изменение количества
 func (h *OrderItemAPIHandler) UpdateOrderItem(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	// Получаем текущего пользователя
 	currentUser := h.authMiddleware.GetCurrentUser(r)
 	if currentUser == nil {
-		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
 		return
 	}
 
-	idStr := r.URL.Path[len("/api/order-items/"):]
-	deviceID, err := strconv.Atoi(idStr)
+	deviceID, err := router.UintParam(r, "deviceId")
 	if err != nil {
-		http.Error(w, "Invalid device ID", http.StatusBadRequest)
-		return
-	}
-
-	// Находим текущую корзину пользователя
-	var order models.SmartOrder
-	result := h.db.Where("status = ? AND client_id = ?", "draft", currentUser.ClientID).First(&order)
-	if result.Error != nil {
-		http.Error(w, "Cart not found", http.StatusNotFound)
+		apperr.Write(w, r, apperr.InvalidParam("deviceId", err))
 		return
 	}
 
 	var request struct {
-		Quantity int `json:"quantity"`
+		Quantity int `json:"quantity" validate:"min=1,max=1000"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := validate.DecodeJSON(w, r, &request); err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
-	if request.Quantity <= 0 {
-		http.Error(w, "Quantity must be positive", http.StatusBadRequest)
-		return
-	}
-
-	// Ищем устройство ИМЕННО в этой корзине
 	var orderItem models.OrderItem
-	result = h.db.Where("order_id = ? AND device_id = ?", order.ID, deviceID).First(&orderItem)
-	if result.Error != nil {
-		http.Error(w, "Device not found in cart", http.StatusNotFound)
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Находим текущую корзину пользователя
+		order, err := lockDraft(tx, currentUser.ClientID)
+		if err != nil {
+			return err
+		}
+
+		// Ищем устройство ИМЕННО в этой корзине
+		if err := tx.Where("order_id = ? AND device_id = ?", order.ID, deviceID).First(&orderItem).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperr.NotFound("Device not found in cart")
+			}
+			return err
+		}
+
+		orderItem.Quantity = request.Quantity
+		return tx.Save(&orderItem).Error
+	})
+	if err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
-	orderItem.Quantity = request.Quantity
-	h.db.Save(&orderItem)
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"device_id": orderItem.DeviceID,
@@ -92,19 +87,10 @@ func (h *OrderItemAPIHandler) UpdateOrderItem(w http.ResponseWriter, r *http.Req
 
 // DELETE /api/order-items/{deviceId} - удаление из заявки
 func (h *OrderItemAPIHandler) DeleteOrderItem(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	// Получаем текущего пользователя
 	currentUser := h.authMiddleware.GetCurrentUser(r)
 	if currentUser == nil {
-		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
 		return
 	}
 
@@ -112,40 +98,54 @@ func (h *OrderItemAPIHandler) DeleteOrderItem(w http.ResponseWriter, r *http.Req
 	path := r.URL.Path
 	log.Printf("🛠️ DeleteOrderItem path: %s", path)
 
-	idStr := r.URL.Path[len("/api/order-items/"):]
-	log.Printf("🛠️ DeleteOrderItem idStr: %s", idStr)
-
-	deviceID, err := strconv.Atoi(idStr)
+	deviceID, err := router.UintParam(r, "deviceId")
 	if err != nil {
 		log.Printf("❌ Error converting deviceID: %v", err)
-		http.Error(w, "Invalid device ID: "+err.Error(), http.StatusBadRequest)
+		apperr.Write(w, r, apperr.InvalidParam("deviceId", err))
 		return
 	}
 
 	log.Printf("🛠️ DeleteOrderItem deviceID: %d", deviceID)
 
-	// Находим текущую корзину пользователя
-	var order models.SmartOrder
-	result := h.db.Where("status = ? AND client_id = ?", "draft", currentUser.ClientID).First(&order)
-	if result.Error != nil {
-		log.Printf("❌ Cart not found: %v", result.Error)
-		http.Error(w, "Cart not found", http.StatusNotFound)
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Находим текущую корзину пользователя
+		order, err := lockDraft(tx, currentUser.ClientID)
+		if err != nil {
+			log.Printf("❌ Cart not found: %v", err)
+			return err
+		}
+
+		log.Printf("🛠️ Found cart: ID=%d", order.ID)
+
+		// Удаляем устройство ИЗ ЭТОЙ КОРЗИНЫ
+		var orderItem models.OrderItem
+		if err := tx.Where("order_id = ? AND device_id = ?", order.ID, deviceID).First(&orderItem).Error; err != nil {
+			log.Printf("❌ Device %d not found in cart %d: %v", deviceID, order.ID, err)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperr.NotFound("Device not found in cart")
+			}
+			return err
+		}
+
+		log.Printf("🛠️ Deleting device %d from cart %d", deviceID, order.ID)
+		return tx.Delete(&orderItem).Error
+	})
+	if err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
-	log.Printf("🛠️ Found cart: ID=%d", order.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	// Удаляем устройство ИЗ ЭТОЙ КОРЗИНЫ
-	var orderItem models.OrderItem
-	result = h.db.Where("order_id = ? AND device_id = ?", order.ID, deviceID).First(&orderItem)
-	if result.Error != nil {
-		log.Printf("❌ Device %d not found in cart %d: %v", deviceID, order.ID, result.Error)
-		http.Error(w, "Device not found in cart", http.StatusNotFound)
-		return
+// lockDraft блокирует черновик клиента: изменение состава не пересекается с формированием заявки
+func lockDraft(tx *gorm.DB, clientID uint) (models.SmartOrder, error) {
+	var order models.SmartOrder
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("status = ? AND client_id = ?", orderstate.StatusDraft, clientID).
+		First(&order).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return order, apperr.NotFound("Cart not found")
 	}
-
-	log.Printf("🛠️ Deleting device %d from cart %d", deviceID, order.ID)
-	h.db.Delete(&orderItem)
-
-	w.WriteHeader(http.StatusNoContent)
+	return order, err
 }
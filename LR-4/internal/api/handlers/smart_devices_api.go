@@ -2,123 +2,215 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
+	"unicode/utf8"
 
 	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/apperr"
+	"smartdevices/internal/devicefilter"
+	"smartdevices/internal/gallery"
+	"smartdevices/internal/images"
 	"smartdevices/internal/middleware"
 	"smartdevices/internal/models"
+	"smartdevices/internal/orderstate"
+	"smartdevices/internal/pagination"
+	"smartdevices/internal/router"
 	"smartdevices/internal/storage"
+	"smartdevices/internal/validate"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type SmartDeviceAPIHandler struct {
 	db             *gorm.DB
 	authMiddleware *middleware.AuthMiddleware
+	storage        storage.ObjectStore
+	imageLimits    images.Limits
 }
 
-func NewSmartDeviceAPIHandler(db *gorm.DB) *SmartDeviceAPIHandler {
+func NewSmartDeviceAPIHandler(db *gorm.DB, authMiddleware *middleware.AuthMiddleware, storage storage.ObjectStore, imageLimits images.Limits) *SmartDeviceAPIHandler {
 	return &SmartDeviceAPIHandler{
 		db:             db,
-		authMiddleware: middleware.NewAuthMiddleware(db),
+		authMiddleware: authMiddleware,
+		storage:        storage,
+		imageLimits:    imageLimits,
 	}
 }
 
-// GET /api/smart-devices - список с фильтрацией
+// smartDevicePages - допустимые поля сортировки списка устройств
+var smartDevicePages = pagination.Spec[models.SmartDevice]{
+	Fields: map[string]pagination.Field[models.SmartDevice]{
+		"id":            {Column: "id", Value: func(d models.SmartDevice) any { return d.ID }},
+		"name":          {Column: "name", Value: func(d models.SmartDevice) any { return d.Name }},
+		"data_per_hour": {Column: "data_per_hour", Value: func(d models.SmartDevice) any { return d.DataPerHour }},
+		"avg_data_rate": {Column: "avg_data_rate", Value: func(d models.SmartDevice) any { return d.AvgDataRate }},
+		"created_at":    {Column: "created_at", Value: func(d models.SmartDevice) any { return d.CreatedAt }},
+	},
+	Default: "id",
+}
+
+// GET /api/smart-devices - список с фильтрацией и пагинацией
 func (h *SmartDeviceAPIHandler) GetSmartDevices(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	// Неактивные устройства видны только модератору
+	isModerator := false
+	if s, err := h.authMiddleware.GetSession(r); err == nil {
+		isModerator = s.IsModerator
+	}
 
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	filter, err := devicefilter.FromQuery(r.URL.Query(), isModerator)
+	if err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
-	search := r.URL.Query().Get("search")
-	protocol := r.URL.Query().Get("protocol")
+	pageParams, err := pagination.Parse(r, smartDevicePages)
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
 
-	var devices []models.SmartDevice
-	query := h.db.Where("is_active = ?", true)
+	query := filter.Apply(h.db).Preload("DeviceType")
 
-	if search != "" {
-		query = query.Where("name ILIKE ? OR description ILIKE ?",
-			"%"+search+"%", "%"+search+"%")
+	// При поиске без явной сортировки выдаем самые релевантные первыми
+	if filter.Search != "" && r.URL.Query().Get("sort") == "" {
+		if pageParams, err = pageParams.Ranked(); err != nil {
+			apperr.Write(w, r, err)
+			return
+		}
+		query = filter.OrderByRank(query)
 	}
 
-	if protocol != "" {
-		query = query.Where("protocol = ?", protocol)
+	devices, page, err := pagination.Query(query, pageParams)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
 	}
 
-	result := query.Find(&devices)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	ids := make([]uint, len(devices))
+	for i, device := range devices {
+		ids[i] = device.ID
+	}
+	highlights, err := filter.Highlights(h.db, ids)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+	imageSets, err := h.imageSets(devices...)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
 		return
 	}
 
 	var response []serializers.SmartDeviceResponse
 	for _, device := range devices {
-		response = append(response, serializers.SmartDeviceToJSON(device))
+		item := serializers.SmartDeviceToJSON(device)
+		item.ImageSrcset = imageSets[device.NamespaceURL].Map()
+		if hl, ok := highlights[device.ID]; ok {
+			item.Highlight = &hl
+		}
+		response = append(response, item)
 	}
 
+	pagination.WriteHeaders(w, r, page)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// GET /api/smart-devices/{id} - одна запись
-func (h *SmartDeviceAPIHandler) GetSmartDevice(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// GET /api/smart-devices/suggest?q= - автодополнение по началу слов
+func (h *SmartDeviceAPIHandler) SuggestSmartDevices(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if utf8.RuneCountInString(q) > 100 {
+		apperr.Write(w, r, apperr.Validation(apperr.FieldError{Field: "q", Code: "max", Message: "q must contain at most 100 characters"}))
+		return
+	}
 
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 20 {
+			apperr.Write(w, r, apperr.InvalidParam("limit", err))
+			return
+		}
+		limit = n
+	}
+
+	suggestions, err := devicefilter.Suggest(h.db, q, limit)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
 		return
 	}
 
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-devices/")
-	id, err := strconv.Atoi(idStr)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
+
+// GET /api/smart-devices/{id} - одна запись
+func (h *SmartDeviceAPIHandler) GetSmartDevice(w http.ResponseWriter, r *http.Request) {
+	id, err := router.UintParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
 		return
 	}
 
 	var device models.SmartDevice
-	result := h.db.First(&device, id)
+	result := h.db.Preload("DeviceType").First(&device, id)
 	if result.Error != nil {
-		http.Error(w, "Device not found", http.StatusNotFound)
+		apperr.Write(w, r, apperr.NotFound("Device not found"))
+		return
+	}
+
+	imageSets, err := h.imageSets(device)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	list, err := gallery.List(h.db, device.ID)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+	gallerySets, err := h.gallerySets(list)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
 		return
 	}
 
+	response := serializers.SmartDeviceToJSON(device)
+	response.ImageSrcset = imageSets[device.NamespaceURL].Map()
+	response.Images = galleryToJSON(list, gallerySets)
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(serializers.SmartDeviceToJSON(device))
+	json.NewEncoder(w).Encode(response)
 }
 
-// POST /api/smart-devices - добавление устройства
-func (h *SmartDeviceAPIHandler) CreateSmartDevice(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
+// imageSets загружает размеры картинок устройств для srcset, по NamespaceURL
+func (h *SmartDeviceAPIHandler) imageSets(devices ...models.SmartDevice) (map[string]images.Set, error) {
+	urls := make([]string, 0, len(devices))
+	for _, device := range devices {
+		if device.NamespaceURL != "" {
+			urls = append(urls, device.NamespaceURL)
+		}
 	}
+	return images.LoadSets(h.db, h.storage, urls)
+}
 
+// POST /api/smart-devices - добавление устройства
+func (h *SmartDeviceAPIHandler) CreateSmartDevice(w http.ResponseWriter, r *http.Request) {
 	var req serializers.SmartDeviceCreateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
-	if req.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+	deviceType, err := h.findDeviceType(req.DeviceTypeID)
+	if err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
@@ -132,13 +224,15 @@ func (h *SmartDeviceAPIHandler) CreateSmartDevice(w http.ResponseWriter, r *http
 		DescriptionAll: req.DescriptionAll,
 		Protocol:       req.Protocol,
 		IsActive:       true,
+		DeviceTypeID:   req.DeviceTypeID,
 	}
 
-	result := h.db.Create(&device)
+	result := h.db.Omit("DeviceType").Create(&device)
 	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		apperr.Write(w, r, apperr.Internal(result.Error))
 		return
 	}
+	device.DeviceType = deviceType
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -147,32 +241,32 @@ func (h *SmartDeviceAPIHandler) CreateSmartDevice(w http.ResponseWriter, r *http
 
 // PUT /api/smart-devices/{id} - изменение устройства
 func (h *SmartDeviceAPIHandler) UpdateSmartDevice(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-devices/")
-	id, err := strconv.Atoi(idStr)
+	id, err := router.UintParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
 		return
 	}
 
 	var device models.SmartDevice
 	result := h.db.First(&device, id)
 	if result.Error != nil {
-		http.Error(w, "Device not found", http.StatusNotFound)
+		apperr.Write(w, r, apperr.NotFound("Device not found"))
 		return
 	}
 
-	var req serializers.SmartDeviceCreateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req serializers.SmartDeviceUpdateRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	// Без device_type_id в теле тип остается прежним
+	if req.DeviceTypeID.Set {
+		device.DeviceTypeID = req.DeviceTypeID.Value
+	}
+	deviceType, err := h.findDeviceType(device.DeviceTypeID)
+	if err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
@@ -180,12 +274,15 @@ func (h *SmartDeviceAPIHandler) UpdateSmartDevice(w http.ResponseWriter, r *http
 	device.Model = req.Model
 	device.AvgDataRate = req.AvgDataRate
 	device.DataPerHour = req.DataPerHour
-	device.NamespaceURL = req.NamespaceURL
 	device.Description = req.Description
 	device.DescriptionAll = req.DescriptionAll
 	device.Protocol = req.Protocol
 
-	h.db.Save(&device)
+	if err := h.db.Omit("DeviceType").Save(&device).Error; err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+	device.DeviceType = deviceType
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(serializers.SmartDeviceToJSON(device))
@@ -193,26 +290,16 @@ func (h *SmartDeviceAPIHandler) UpdateSmartDevice(w http.ResponseWriter, r *http
 
 // DELETE /api/smart-devices/{id} - удаление устройства (БЕЗ удаления изображения из MinIO)
 func (h *SmartDeviceAPIHandler) DeleteSmartDevice(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-devices/")
-	id, err := strconv.Atoi(idStr)
+	id, err := router.UintParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
 		return
 	}
 
 	var device models.SmartDevice
 	result := h.db.First(&device, id)
 	if result.Error != nil {
-		http.Error(w, "Device not found", http.StatusNotFound)
+		apperr.Write(w, r, apperr.NotFound("Device not found"))
 		return
 	}
 
@@ -226,124 +313,210 @@ func (h *SmartDeviceAPIHandler) DeleteSmartDevice(w http.ResponseWriter, r *http
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// POST /api/smart-devices/{id}/image - добавление изображения
+// findDeviceType загружает тип, указанный в запросе; nil - тип не задан
+func (h *SmartDeviceAPIHandler) findDeviceType(id *uint) (*models.DeviceType, error) {
+	if id == nil {
+		return nil, nil
+	}
+
+	var deviceType models.DeviceType
+	if err := h.db.First(&deviceType, *id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperr.Validation(apperr.FieldError{Field: "device_type_id", Code: "not_found", Message: "device_type_id refers to unknown device type"})
+		}
+		return nil, apperr.Internal(err)
+	}
+	return &deviceType, nil
+}
+
+// POST /api/smart-devices/{id}/image - замена главной картинки устройства.
+// Прежняя главная картинка удаляется из галереи и хранилища.
 func (h *SmartDeviceAPIHandler) UploadDeviceImage(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	id, err := router.UintParam(r, "id")
+	if err != nil {
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
+		return
+	}
 
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	var device models.SmartDevice
+	result := h.db.First(&device, id)
+	if result.Error != nil {
+		apperr.Write(w, r, apperr.NotFound("Device not found"))
 		return
 	}
 
-	// Парсим multipart form
-	err := r.ParseMultipartForm(32 << 20) // 32 MB max
+	form, img, key, err := h.receiveImage(w, r, device.ID)
 	if err != nil {
-		http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
+		apperr.Write(w, r, err)
 		return
 	}
 
-	// Получаем файл из формы
-	file, handler, err := r.FormFile("image")
+	image, err := gallery.Replace(r.Context(), h.db, h.storage, device, key, form.AltText)
 	if err != nil {
-		http.Error(w, "Failed to get image file: "+err.Error(), http.StatusBadRequest)
+		apperr.Write(w, r, galleryError(err))
 		return
 	}
-	defer file.Close()
 
-	// Читаем файл в память
-	fileData, err := io.ReadAll(file)
+	sets, err := h.gallerySets([]models.DeviceImage{image})
 	if err != nil {
-		http.Error(w, "Failed to read file: "+err.Error(), http.StatusInternalServerError)
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"message":      "Image uploaded successfully",
+		"image_id":     image.ID,
+		"image_url":    image.URL,
+		"file_name":    key,
+		"file_size":    img.BytesRead(),
+		"content_type": img.Format.ContentType,
+		"width":        img.Width,
+		"height":       img.Height,
+		"image_srcset": sets[image.URL].Map(),
+	})
+}
+
+// POST /api/smart-devices/{id}/draft - добавление устройства в заявку-черновик
+func (h *SmartDeviceAPIHandler) AddDeviceToDraft(w http.ResponseWriter, r *http.Request) {
+	// Получаем текущего пользователя
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
 		return
 	}
 
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-devices/")
-	idStr = strings.TrimSuffix(idStr, "/image")
-	id, err := strconv.Atoi(idStr)
+	id, err := router.UintParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
 		return
 	}
 
 	var device models.SmartDevice
-	result := h.db.First(&device, id)
+	result := h.db.Where("is_active = ?", true).First(&device, id)
 	if result.Error != nil {
-		http.Error(w, "Device not found", http.StatusNotFound)
+		apperr.Write(w, r, apperr.NotFound("Device not found"))
 		return
 	}
 
-	// Генерируем имя файла на латинице
-	fileExt := ".png"
-	if strings.Contains(handler.Filename, ".") {
-		fileExt = filepath.Ext(handler.Filename)
-	}
-	newFileName := fmt.Sprintf("device_%d_%d%s", device.ID, time.Now().Unix(), fileExt)
+	var order models.SmartOrder
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Блокировка строки клиента: параллельные добавления не создадут второй черновик
+		// (его не допускает и индекс idx_smart_orders_draft)
+		var client models.Client
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&client, currentUser.ClientID).Error; err != nil {
+			return err
+		}
+
+		// Ищем черновик пользователя (с блокировкой: формирование ждет добавления) или создаем новый
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("status = ? AND client_id = ?", orderstate.StatusDraft, currentUser.ClientID).First(&order)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			order = models.SmartOrder{
+				Status:   orderstate.StatusDraft,
+				ClientID: currentUser.ClientID,
+			}
+			if err := tx.Create(&order).Error; err != nil {
+				return err
+			}
+			event := orderstate.StatusEvent(order, "", currentUser.ClientID)
+			if err := tx.Create(&event).Error; err != nil {
+				return err
+			}
+			fmt.Printf("📝 Создана новая корзина ID: %d (клиент %d)\n", order.ID, currentUser.ClientID)
+		} else if result.Error != nil {
+			return result.Error
+		}
+
+		// Если устройство уже в заявке - увеличиваем количество одним UPDATE
+		result = tx.Model(&models.OrderItem{}).
+			Where("order_id = ? AND device_id = ?", order.ID, device.ID).
+			Update("quantity", gorm.Expr("quantity + 1"))
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
 
-	// Загружаем файл в MinIO
-	minioClient := storage.NewMinIOClient()
-	err = minioClient.UploadFile(newFileName, fileData)
+		orderItem := models.OrderItem{
+			OrderID:  order.ID,
+			DeviceID: device.ID,
+			Quantity: 1,
+		}
+		return tx.Create(&orderItem).Error
+	})
 	if err != nil {
-		fmt.Printf("❌ MinIO upload failed: %v\n", err)
-		http.Error(w, "Failed to upload image to storage: "+err.Error(), http.StatusInternalServerError)
+		apperr.Write(w, r, apperr.Internal(err))
 		return
 	}
 
-	// Обновляем URL в БД
-	namespaceURL := minioClient.GetImageURL(newFileName)
-	device.NamespaceURL = namespaceURL
-	h.db.Save(&device)
+	if err := h.db.Preload("Client").First(&order, order.ID).Error; err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
 
-	fmt.Printf("✅ Image uploaded: %s (%d bytes)\n", newFileName, len(fileData))
+	var items []models.OrderItem
+	if err := h.db.Preload("Device").Where("order_id = ?", order.ID).Find(&items).Error; err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	var itemResponses []serializers.SmartOrderItemResponse
+	for _, item := range items {
+		itemResponses = append(itemResponses, serializers.SmartOrderItemResponse{
+			DeviceID:     item.DeviceID,
+			DeviceName:   item.Device.Name,
+			Quantity:     item.Quantity,
+			DataPerHour:  item.Device.DataPerHour,
+			NamespaceURL: item.Device.NamespaceURL,
+		})
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":   true,
-		"message":   "Image uploaded successfully",
-		"image_url": namespaceURL,
-		"file_name": newFileName,
-		"file_size": len(fileData),
-	})
+	json.NewEncoder(w).Encode(serializers.SmartOrderToJSON(order, itemResponses))
 }
 
-// DELETE /api/smart-devices/{id}/image - удаление изображения устройства
+// DELETE /api/smart-devices/{id}/image - удаление главной картинки устройства.
+// Главной становится следующая картинка галереи.
 func (h *SmartDeviceAPIHandler) DeleteDeviceImage(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-devices/")
-	idStr = strings.TrimSuffix(idStr, "/image")
-	id, err := strconv.Atoi(idStr)
+	id, err := router.UintParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
 		return
 	}
 
 	var device models.SmartDevice
 	result := h.db.First(&device, id)
 	if result.Error != nil {
-		http.Error(w, "Device not found", http.StatusNotFound)
+		apperr.Write(w, r, apperr.NotFound("Device not found"))
 		return
 	}
 
-	// Удаляем изображение из MinIO если есть
-	if device.NamespaceURL != "" && strings.Contains(device.NamespaceURL, "localhost:9000") {
-		filename := filepath.Base(device.NamespaceURL)
-		minioClient := storage.NewMinIOClient()
-		err := minioClient.DeleteFile(filename)
+	var primary []models.DeviceImage
+	if err := h.db.Where("device_id = ? AND is_primary", device.ID).Find(&primary).Error; err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	if len(primary) > 0 {
+		if err := gallery.Delete(r.Context(), h.db, h.storage, primary[0]); err != nil {
+			apperr.Write(w, r, galleryError(err))
+			return
+		}
+		fmt.Printf("✅ Image deleted from storage: %s\n", primary[0].Key)
+	} else if filename, ok := h.storage.Key(device.NamespaceURL); ok {
+		// Картинка, загруженная до появления галереи
+		if err := images.DeleteVariants(r.Context(), h.db, h.storage, filename); err != nil {
+			fmt.Printf("⚠️ Failed to delete image variants: %v\n", err)
+			apperr.Write(w, r, apperr.Internal(err))
+			return
+		}
+
+		err := h.storage.Delete(r.Context(), filename)
 		if err != nil {
-			fmt.Printf("⚠️ Failed to delete image from MinIO: %v\n", err)
-			http.Error(w, "Failed to delete image from storage", http.StatusInternalServerError)
+			fmt.Printf("⚠️ Failed to delete image from storage: %v\n", err)
+			apperr.Write(w, r, apperr.Internal(err))
 			return
 		} else {
-			fmt.Printf("✅ Image deleted from MinIO: %s\n", filename)
+			fmt.Printf("✅ Image deleted from storage: %s\n", filename)
 		}
 
 		// Очищаем URL в БД
@@ -2,45 +2,52 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/apperr"
+	"smartdevices/internal/compat"
 	"smartdevices/internal/middleware"
 	"smartdevices/internal/models"
+	"smartdevices/internal/orderstate"
+	"smartdevices/internal/pagination"
+	"smartdevices/internal/router"
+	"smartdevices/internal/session"
+	"smartdevices/internal/traffic"
+	"smartdevices/internal/validate"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type SmartOrderAPIHandler struct {
 	db             *gorm.DB
 	authMiddleware *middleware.AuthMiddleware
+	traffic        traffic.Calculator
+	compat         *compat.Engine
 }
 
-func NewSmartOrderAPIHandler(db *gorm.DB) *SmartOrderAPIHandler {
+func NewSmartOrderAPIHandler(db *gorm.DB, authMiddleware *middleware.AuthMiddleware, calculator traffic.Calculator, compatibility *compat.Engine) *SmartOrderAPIHandler {
 	return &SmartOrderAPIHandler{
 		db:             db,
-		authMiddleware: middleware.NewAuthMiddleware(db),
+		authMiddleware: authMiddleware,
+		traffic:        calculator,
+		compat:         compatibility,
 	}
 }
 
 // GET /api/smart-orders/cart - иконка корзины
 func (h *SmartOrderAPIHandler) GetCart(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	// Получаем текущего пользователя
 	currentUser := h.authMiddleware.GetCurrentUser(r)
 	if currentUser == nil {
-		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
 		return
 	}
 
@@ -72,21 +79,23 @@ func (h *SmartOrderAPIHandler) GetCart(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// smartOrderPages - допустимые поля сортировки списка заявок
+var smartOrderPages = pagination.Spec[models.SmartOrder]{
+	Fields: map[string]pagination.Field[models.SmartOrder]{
+		"id":            {Column: "id", Value: func(o models.SmartOrder) any { return o.ID }},
+		"created_at":    {Column: "created_at", Value: func(o models.SmartOrder) any { return o.CreatedAt }},
+		"status":        {Column: "status", Value: func(o models.SmartOrder) any { return o.Status }},
+		"total_traffic": {Column: "total_traffic", Value: func(o models.SmartOrder) any { return o.TotalTraffic }},
+	},
+	Default: "-created_at",
+}
+
 // GET /api/smart-orders - список заявок (кроме удаленных и черновика)
 func (h *SmartOrderAPIHandler) GetSmartOrders(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	// Получаем текущего пользователя
 	currentUser := h.authMiddleware.GetCurrentUser(r)
 	if currentUser == nil {
-		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
 		return
 	}
 
@@ -94,7 +103,12 @@ func (h *SmartOrderAPIHandler) GetSmartOrders(w http.ResponseWriter, r *http.Req
 	dateFromStr := r.URL.Query().Get("date_from")
 	dateToStr := r.URL.Query().Get("date_to")
 
-	var orders []models.SmartOrder
+	pageParams, err := pagination.Parse(r, smartOrderPages)
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
 	query := h.db.Preload("Client").Preload("Moderator")
 
 	// Если не модератор - показываем только свои заявки
@@ -121,9 +135,9 @@ func (h *SmartOrderAPIHandler) GetSmartOrders(w http.ResponseWriter, r *http.Req
 		}
 	}
 
-	result := query.Find(&orders)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	orders, page, err := pagination.Query(query, pageParams)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
 		return
 	}
 
@@ -146,50 +160,44 @@ func (h *SmartOrderAPIHandler) GetSmartOrders(w http.ResponseWriter, r *http.Req
 		response = append(response, serializers.SmartOrderToJSON(order, itemResponses))
 	}
 
+	pagination.WriteHeaders(w, r, page)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
 // GET /api/smart-orders/{id} - одна заявка
 func (h *SmartOrderAPIHandler) GetSmartOrder(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	// Получаем текущего пользователя
 	currentUser := h.authMiddleware.GetCurrentUser(r)
 	if currentUser == nil {
-		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
 		return
 	}
 
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-orders/")
-	id, err := strconv.Atoi(idStr)
+	id, err := router.UintParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
 		return
 	}
 
 	var order models.SmartOrder
 	result := h.db.Preload("Client").Preload("Moderator").First(&order, id)
 	if result.Error != nil || order.Status == "deleted" {
-		http.Error(w, "Order not found", http.StatusNotFound)
+		apperr.Write(w, r, apperr.NotFound("Order not found"))
 		return
 	}
 
 	// Проверяем права доступа
 	if !currentUser.IsModerator && order.ClientID != currentUser.ClientID {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		apperr.Write(w, r, apperr.Forbidden("Access denied"))
 		return
 	}
 
-	var items []models.OrderItem
-	h.db.Preload("Device").Where("order_id = ?", order.ID).Find(&items)
+	items, err := traffic.LoadItems(h.db, order.ID)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
 
 	var itemResponses []serializers.SmartOrderItemResponse
 	for _, item := range items {
@@ -203,6 +211,8 @@ func (h *SmartOrderAPIHandler) GetSmartOrder(w http.ResponseWriter, r *http.Requ
 	}
 
 	response := serializers.SmartOrderToJSON(order, itemResponses)
+	breakdown := traffic.ForOrder(h.traffic, order, items)
+	response.Traffic = &breakdown
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -210,54 +220,55 @@ func (h *SmartOrderAPIHandler) GetSmartOrder(w http.ResponseWriter, r *http.Requ
 
 // PUT /api/smart-orders/{id} - изменение полей заявки
 func (h *SmartOrderAPIHandler) UpdateSmartOrder(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	// Получаем текущего пользователя
 	currentUser := h.authMiddleware.GetCurrentUser(r)
 	if currentUser == nil {
-		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
 		return
 	}
 
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-orders/")
-	id, err := strconv.Atoi(idStr)
+	id, err := router.UintParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
 		return
 	}
 
 	var order models.SmartOrder
 	result := h.db.First(&order, id)
 	if result.Error != nil || order.Status == "deleted" {
-		http.Error(w, "Order not found", http.StatusNotFound)
+		apperr.Write(w, r, apperr.NotFound("Order not found"))
 		return
 	}
 
 	// Проверяем права доступа
 	if !currentUser.IsModerator && order.ClientID != currentUser.ClientID {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		apperr.Write(w, r, apperr.Forbidden("Access denied"))
+		return
+	}
+
+	if err := orderstate.CanEdit(order, actorFromSession(currentUser)); err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
 	var req serializers.SmartOrderUpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
 	// Обновляем только разрешенные поля
-	if req.Address != "" {
+	oldStatus := order.Status
+	var events []models.OrderEvent
+	if req.Address != "" && req.Address != order.Address {
+		events = append(events, orderstate.FieldEvent(order, "address", order.Address, req.Address, currentUser.ClientID))
 		order.Address = req.Address
 	}
 
-	h.db.Save(&order)
+	if err := orderstate.SaveWithEvents(h.db, &order, oldStatus, events...); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(serializers.SmartOrderToJSON(order, nil))
@@ -265,55 +276,71 @@ func (h *SmartOrderAPIHandler) UpdateSmartOrder(w http.ResponseWriter, r *http.R
 
 // PUT /api/smart-orders/{id}/form - формирование заявки
 func (h *SmartOrderAPIHandler) FormSmartOrder(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	// Получаем текущего пользователя
 	currentUser := h.authMiddleware.GetCurrentUser(r)
 	if currentUser == nil {
-		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
 		return
 	}
 
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-orders/")
-	idStr = strings.TrimSuffix(idStr, "/form")
-	id, err := strconv.Atoi(idStr)
+	id, err := router.UintParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
 		return
 	}
 
 	var order models.SmartOrder
 	result := h.db.First(&order, id)
 	if result.Error != nil {
-		http.Error(w, "Order not found", http.StatusNotFound)
+		apperr.Write(w, r, apperr.NotFound("Order not found"))
 		return
 	}
 
 	// Проверяем права доступа
 	if !currentUser.IsModerator && order.ClientID != currentUser.ClientID {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		apperr.Write(w, r, apperr.Forbidden("Access denied"))
 		return
 	}
 
-	// Проверка обязательных полей
-	if order.Address == "" {
-		http.Error(w, "Address is required to form order", http.StatusBadRequest)
-		return
-	}
+	// Блокируем заявку до сохранения: состав не меняется между проверкой совместимости и формированием
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+			return err
+		}
 
-	// Установка статуса и даты формирования
-	now := time.Now()
-	order.Status = "formed"
-	order.FormedAt = &now
+		if err := orderstate.Can(order, orderstate.ActionForm, actorFromSession(currentUser)); err != nil {
+			return err
+		}
 
-	h.db.Save(&order)
+		// Проверка обязательных полей
+		if order.Address == "" {
+			return apperr.Validation(apperr.FieldError{Field: "address", Code: "required", Message: "Address is required to form order"})
+		}
+
+		// Совместимость устройств: протоколы без шлюза, емкость хабов
+		items, err := traffic.LoadItems(tx, order.ID)
+		if err != nil {
+			return apperr.Internal(err)
+		}
+		report, err := h.checkCompatibility(tx, items)
+		if err != nil {
+			return apperr.Internal(err)
+		}
+		if !report.OK {
+			return compatibilityError(report)
+		}
+
+		// Установка статуса и даты формирования
+		oldStatus := order.Status
+		orderstate.Apply(&order, orderstate.ActionForm, actorFromSession(currentUser))
+		events := []models.OrderEvent{orderstate.StatusEvent(order, oldStatus, currentUser.ClientID)}
+
+		return orderstate.SaveWithEvents(tx, &order, oldStatus, events...)
+	})
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(serializers.SmartOrderToJSON(order, nil))
@@ -321,80 +348,71 @@ func (h *SmartOrderAPIHandler) FormSmartOrder(w http.ResponseWriter, r *http.Req
 
 // PUT /api/smart-orders/{id}/complete - завершение заявки
 func (h *SmartOrderAPIHandler) CompleteSmartOrder(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	// Проверяем права модератора
 	currentUser := h.authMiddleware.GetCurrentUser(r)
 	if currentUser == nil || !currentUser.IsModerator {
-		http.Error(w, `{"error": "Moderator access required"}`, http.StatusForbidden)
+		apperr.Write(w, r, apperr.Forbidden("Moderator access required"))
 		return
 	}
 
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-orders/")
-	idStr = strings.TrimSuffix(idStr, "/complete")
-	id, err := strconv.Atoi(idStr)
+	id, err := router.UintParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
 		return
 	}
 
 	var order models.SmartOrder
 	result := h.db.Preload("Client").First(&order, id)
 	if result.Error != nil {
-		http.Error(w, "Order not found", http.StatusNotFound)
+		apperr.Write(w, r, apperr.NotFound("Order not found"))
 		return
 	}
 
-	// Проверяем что заявка сформирована
-	if order.Status != "formed" {
-		http.Error(w, "Only formed orders can be completed", http.StatusBadRequest)
+	// Проверяем что заявку можно завершить
+	if err := orderstate.Can(order, orderstate.ActionComplete, actorFromSession(currentUser)); err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
-	// Расчет общего трафика по формуле из лабы 2
-	var items []models.OrderItem
-	h.db.Preload("Device").Where("order_id = ?", order.ID).Find(&items)
-
-	totalTraffic := 0.0
-	for _, item := range items {
-		baseTraffic := item.Device.DataPerHour * float64(item.Quantity)
-
-		// Формула расчета с коэффициентами для разных типов устройств
-		var coefficient float64
-		switch {
-		case strings.Contains(item.Device.Name, "Хаб"):
-			coefficient = 1.3 // Хабы требуют больше трафика
-		case strings.Contains(item.Device.Name, "Датчик"):
-			coefficient = 0.7 // Датчики экономят трафик
-		case strings.Contains(item.Device.Name, "Лампочка"):
-			coefficient = 1.1 // Лампочки немного больше
-		case strings.Contains(item.Device.Name, "Розетка"):
-			coefficient = 0.9 // Розетки мало трафика
-		case strings.Contains(item.Device.Name, "Выключатель"):
-			coefficient = 0.8 // Выключатели мало трафика
-		default:
-			coefficient = 1.0
-		}
-
-		traffic := baseTraffic * coefficient
-		totalTraffic += traffic
+	// Расчет общего трафика тем же калькулятором, что и в корзине
+	items, err := traffic.LoadItems(h.db, order.ID)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
 	}
+	breakdown := h.traffic.Calculate(traffic.ItemsOf(items))
+	totalTraffic := breakdown.Total
+	traffic.Record(items, breakdown)
 
 	// Установка статуса, модератора и даты завершения
-	now := time.Now()
-	order.Status = "completed"
-	order.CompletedAt = &now
-	order.ModeratorID = &currentUser.ClientID
+	oldStatus := order.Status
+	oldTraffic := order.TotalTraffic
+	orderstate.Apply(&order, orderstate.ActionComplete, actorFromSession(currentUser))
 	order.TotalTraffic = totalTraffic
+	events := []models.OrderEvent{
+		orderstate.StatusEvent(order, oldStatus, currentUser.ClientID),
+		orderstate.FieldEvent(order, "total_traffic",
+			strconv.FormatFloat(oldTraffic, 'f', -1, 64),
+			strconv.FormatFloat(totalTraffic, 'f', -1, 64),
+			currentUser.ClientID),
+	}
 
-	h.db.Save(&order)
+	// Расшифровка сохраняется вместе со статусом, чтобы итог и позиции всегда совпадали
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		for _, item := range items {
+			err := tx.Model(&models.OrderItem{}).
+				Where("order_id = ? AND device_id = ?", item.OrderID, item.DeviceID).
+				Updates(map[string]any{"traffic_coefficient": item.TrafficCoefficient, "traffic": item.Traffic}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return orderstate.SaveWithEvents(tx, &order, oldStatus, events...)
+	})
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
 
 	// Загружаем items для ответа
 	var itemResponses []serializers.SmartOrderItemResponse
@@ -409,6 +427,7 @@ func (h *SmartOrderAPIHandler) CompleteSmartOrder(w http.ResponseWriter, r *http
 	}
 
 	response := serializers.SmartOrderToJSON(order, itemResponses)
+	response.Traffic = &breakdown
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -416,50 +435,311 @@ func (h *SmartOrderAPIHandler) CompleteSmartOrder(w http.ResponseWriter, r *http
 
 // DELETE /api/smart-orders/{id} - удаление заявки
 func (h *SmartOrderAPIHandler) DeleteSmartOrder(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	// Получаем текущего пользователя
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
+		return
+	}
+
+	id, err := router.UintParam(r, "id")
+	if err != nil {
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
+		return
+	}
+
+	var order models.SmartOrder
+	result := h.db.First(&order, id)
+	if result.Error != nil {
+		apperr.Write(w, r, apperr.NotFound("Order not found"))
+		return
+	}
+
+	// Проверяем права доступа
+	if !currentUser.IsModerator && order.ClientID != currentUser.ClientID {
+		apperr.Write(w, r, apperr.Forbidden("Access denied"))
+		return
+	}
+
+	// Мягкое удаление - меняем статус
+	oldStatus := order.Status
+	if err := orderstate.Apply(&order, orderstate.ActionDelete, actorFromSession(currentUser)); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+	events := []models.OrderEvent{orderstate.StatusEvent(order, oldStatus, currentUser.ClientID)}
+
+	if err := orderstate.SaveWithEvents(h.db, &order, oldStatus, events...); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /api/smart-orders/{id}/reject - отклонение заявки
+func (h *SmartOrderAPIHandler) RejectSmartOrder(w http.ResponseWriter, r *http.Request) {
+	// Проверяем права модератора
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil || !currentUser.IsModerator {
+		apperr.Write(w, r, apperr.Forbidden("Moderator access required"))
+		return
+	}
+
+	id, err := router.UintParam(r, "id")
+	if err != nil {
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
+		return
+	}
+
+	// Причина отклонения необязательна - пустое тело допустимо
+	var req serializers.SmartOrderRejectRequest
+	if err := validate.DecodeJSON(w, r, &req); err != nil && !errors.Is(err, io.EOF) {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	var order models.SmartOrder
+	result := h.db.Preload("Client").First(&order, id)
+	if result.Error != nil {
+		apperr.Write(w, r, apperr.NotFound("Order not found"))
+		return
+	}
+
+	oldStatus := order.Status
+	if err := orderstate.Apply(&order, orderstate.ActionReject, actorFromSession(currentUser)); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+	events := []models.OrderEvent{orderstate.StatusEvent(order, oldStatus, currentUser.ClientID)}
+	if req.Reason != "" {
+		events = append(events, orderstate.FieldEvent(order, "reject_reason", order.RejectReason, req.Reason, currentUser.ClientID))
+		order.RejectReason = req.Reason
+	}
 
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	if err := orderstate.SaveWithEvents(h.db, &order, oldStatus, events...); err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.SmartOrderToJSON(order, nil))
+}
+
+// GET /api/smart-orders/{id}/history - история изменений заявки
+func (h *SmartOrderAPIHandler) GetSmartOrderHistory(w http.ResponseWriter, r *http.Request) {
 	// Получаем текущего пользователя
 	currentUser := h.authMiddleware.GetCurrentUser(r)
 	if currentUser == nil {
-		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
 		return
 	}
 
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-orders/")
-	id, err := strconv.Atoi(idStr)
+	id, err := router.UintParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
 		return
 	}
 
 	var order models.SmartOrder
 	result := h.db.First(&order, id)
 	if result.Error != nil {
-		http.Error(w, "Order not found", http.StatusNotFound)
+		apperr.Write(w, r, apperr.NotFound("Order not found"))
 		return
 	}
 
-	// Проверяем права доступа
+	// Историю видят создатель заявки и модераторы
 	if !currentUser.IsModerator && order.ClientID != currentUser.ClientID {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		apperr.Write(w, r, apperr.Forbidden("Access denied"))
 		return
 	}
 
-	// Мягкое удаление - меняем статус
-	order.Status = "deleted"
-	h.db.Save(&order)
+	var events []models.OrderEvent
+	result = h.db.Preload("Actor").Where("order_id = ?", order.ID).Order("created_at, id").Find(&events)
+	if result.Error != nil {
+		apperr.Write(w, r, apperr.Internal(result.Error))
+		return
+	}
 
-	w.WriteHeader(http.StatusNoContent)
+	response := []serializers.OrderEventResponse{}
+	for _, event := range events {
+		response = append(response, serializers.OrderEventToJSON(event))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// actorFromSession преобразует сессию в участника перехода статусов
+func actorFromSession(s *session.Session) orderstate.Actor {
+	return orderstate.Actor{
+		ClientID:    s.ClientID,
+		IsModerator: s.IsModerator,
+	}
+}
+
+// GET /api/smart-orders/{id}/traffic - прогноз трафика заявки. Для черновика и
+// сформированной заявки считается на лету, для завершенной - сохраненный расчет.
+func (h *SmartOrderAPIHandler) GetSmartOrderTraffic(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
+		return
+	}
+
+	id, err := router.UintParam(r, "id")
+	if err != nil {
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
+		return
+	}
+
+	var order models.SmartOrder
+	result := h.db.First(&order, id)
+	if result.Error != nil || order.Status == "deleted" {
+		apperr.Write(w, r, apperr.NotFound("Order not found"))
+		return
+	}
+
+	if !currentUser.IsModerator && order.ClientID != currentUser.ClientID {
+		apperr.Write(w, r, apperr.Forbidden("Access denied"))
+		return
+	}
+
+	items, err := traffic.LoadItems(h.db, order.ID)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.TrafficPreviewToJSON(order, traffic.ForOrder(h.traffic, order, items)))
+}
+
+// GET /api/smart-orders/cart/traffic - прогноз трафика корзины (пустой, если черновика нет)
+func (h *SmartOrderAPIHandler) GetCartTraffic(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
+		return
+	}
+
+	order := models.SmartOrder{Status: "draft", ClientID: currentUser.ClientID}
+	var items []models.OrderItem
+
+	result := h.db.Where("status = ? AND client_id = ?", "draft", currentUser.ClientID).First(&order)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		apperr.Write(w, r, apperr.Internal(result.Error))
+		return
+	}
+	if result.Error == nil {
+		var err error
+		if items, err = traffic.LoadItems(h.db, order.ID); err != nil {
+			apperr.Write(w, r, apperr.Internal(err))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.TrafficPreviewToJSON(order, h.traffic.Calculate(traffic.ItemsOf(items))))
 }
 
-// Вспомогательная функция
-func uintPtr(i uint) *uint {
-	return &i
+// GET /api/smart-orders/{id}/compatibility - проверка совместимости устройств заявки
+func (h *SmartOrderAPIHandler) GetSmartOrderCompatibility(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
+		return
+	}
+
+	id, err := router.UintParam(r, "id")
+	if err != nil {
+		apperr.Write(w, r, apperr.InvalidParam("id", err))
+		return
+	}
+
+	var order models.SmartOrder
+	result := h.db.First(&order, id)
+	if result.Error != nil || order.Status == "deleted" {
+		apperr.Write(w, r, apperr.NotFound("Order not found"))
+		return
+	}
+
+	if !currentUser.IsModerator && order.ClientID != currentUser.ClientID {
+		apperr.Write(w, r, apperr.Forbidden("Access denied"))
+		return
+	}
+
+	items, err := traffic.LoadItems(h.db, order.ID)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+	report, err := h.checkCompatibility(h.db, items)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.CompatibilityResponse{OrderID: order.ID, Report: report})
+}
+
+// GET /api/smart-orders/cart/compatibility - проверка совместимости корзины до формирования
+func (h *SmartOrderAPIHandler) GetCartCompatibility(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
+		return
+	}
+
+	var order models.SmartOrder
+	var items []models.OrderItem
+
+	result := h.db.Where("status = ? AND client_id = ?", "draft", currentUser.ClientID).First(&order)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		apperr.Write(w, r, apperr.Internal(result.Error))
+		return
+	}
+	if result.Error == nil {
+		var err error
+		if items, err = traffic.LoadItems(h.db, order.ID); err != nil {
+			apperr.Write(w, r, apperr.Internal(err))
+			return
+		}
+	}
+
+	report, err := h.checkCompatibility(h.db, items)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.CompatibilityResponse{OrderID: order.ID, Report: report})
+}
+
+// checkCompatibility проверяет позиции заявки; хабы каталога нужны для подсказок
+func (h *SmartOrderAPIHandler) checkCompatibility(db *gorm.DB, items []models.OrderItem) (compat.Report, error) {
+	hubs, err := compat.LoadHubs(db)
+	if err != nil {
+		return compat.Report{}, err
+	}
+	return h.compat.Check(compat.LinesOf(items), hubs), nil
+}
+
+// compatibilityError - блокирующие проблемы совместимости как ошибка API
+func compatibilityError(report compat.Report) error {
+	e := apperr.New(http.StatusUnprocessableEntity, apperr.CodeIncompatible, "Devices in the order are not compatible")
+	for _, issue := range report.Errors {
+		message := issue.Message
+		if len(issue.Suggestions) > 0 {
+			names := make([]string, 0, len(issue.Suggestions))
+			for _, s := range issue.Suggestions {
+				names = append(names, fmt.Sprintf("%s (id %d)", s.Name, s.DeviceID))
+			}
+			message += ". Add one of: " + strings.Join(names, ", ")
+		}
+		e.Fields = append(e.Fields, apperr.FieldError{Field: "items", Code: issue.Code, Message: message})
+	}
+	return e
 }
@@ -10,13 +10,13 @@ type ClientResponse struct {
 }
 
 type ClientRegisterRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username string `json:"username" validate:"required,min=3,max=150"`
+	Password string `json:"password" validate:"required,min=6,maxbytes=72"` // bcrypt учитывает только 72 байта
 }
 
 type ClientLoginRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username string `json:"username" validate:"required,max=150"`
+	Password string `json:"password" validate:"required,maxbytes=72"`
 }
 
 func ClientToJSON(client models.Client) ClientResponse {
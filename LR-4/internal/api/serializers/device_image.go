@@ -0,0 +1,43 @@
+package serializers
+
+import (
+	"time"
+
+	"smartdevices/internal/images"
+	"smartdevices/internal/models"
+)
+
+type DeviceImageResponse struct {
+	ID          uint              `json:"id"`
+	URL         string            `json:"url"`
+	AltText     string            `json:"alt_text"`
+	Position    int               `json:"position"`
+	IsPrimary   bool              `json:"is_primary"`
+	ImageSrcset map[string]string `json:"image_srcset,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// DeviceImageFields - текстовые поля multipart-формы загрузки картинки
+type DeviceImageFields struct {
+	AltText string `json:"alt_text" validate:"max=300"`
+}
+
+type DeviceImageUpdateRequest struct {
+	AltText string `json:"alt_text" validate:"max=300"`
+}
+
+type DeviceImageOrderRequest struct {
+	ImageIDs []uint `json:"image_ids" validate:"required"`
+}
+
+func DeviceImageToJSON(img models.DeviceImage, set images.Set) DeviceImageResponse {
+	return DeviceImageResponse{
+		ID:          img.ID,
+		URL:         img.URL,
+		AltText:     img.AltText,
+		Position:    img.Position,
+		IsPrimary:   img.IsPrimary,
+		ImageSrcset: set.Map(),
+		CreatedAt:   img.CreatedAt,
+	}
+}
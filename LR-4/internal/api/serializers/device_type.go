@@ -0,0 +1,25 @@
+package serializers
+
+import "smartdevices/internal/models"
+
+type DeviceTypeResponse struct {
+	ID                 uint    `json:"id"`
+	Code               string  `json:"code"`
+	Name               string  `json:"name"`
+	TrafficCoefficient float64 `json:"traffic_coefficient"`
+}
+
+type DeviceTypeRequest struct {
+	Code               string  `json:"code" validate:"required,max=50"`
+	Name               string  `json:"name" validate:"required,max=100"`
+	TrafficCoefficient float64 `json:"traffic_coefficient" validate:"required,min=0.01,max=100"`
+}
+
+func DeviceTypeToJSON(deviceType models.DeviceType) DeviceTypeResponse {
+	return DeviceTypeResponse{
+		ID:                 deviceType.ID,
+		Code:               deviceType.Code,
+		Name:               deviceType.Name,
+		TrafficCoefficient: deviceType.TrafficCoefficient,
+	}
+}
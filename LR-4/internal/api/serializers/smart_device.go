@@ -1,8 +1,11 @@
 package serializers
 
 import (
-	"smartdevices/internal/models"
+	"encoding/json"
 	"time"
+
+	"smartdevices/internal/devicefilter"
+	"smartdevices/internal/models"
 )
 
 type SmartDeviceResponse struct {
@@ -17,21 +20,59 @@ type SmartDeviceResponse struct {
 	Protocol       string    `json:"protocol"`
 	IsActive       bool      `json:"is_active"`
 	CreatedAt      time.Time `json:"created_at"`
+
+	DeviceTypeID *uint               `json:"device_type_id"`
+	DeviceType   *DeviceTypeResponse `json:"device_type,omitempty"`
+
+	// URL картинки по ширине для srcset ("160w", "480w", ..., включая оригинал);
+	// нет для SVG и картинок без уменьшенных копий
+	ImageSrcset map[string]string `json:"image_srcset,omitempty"`
+	// Галерея, по порядку; только в GET /api/smart-devices/{id}
+	Images []DeviceImageResponse `json:"images,omitempty"`
+
+	// Заполняется только при поиске (search=...)
+	Highlight *devicefilter.Highlight `json:"highlight,omitempty"`
 }
 
 type SmartDeviceCreateRequest struct {
-	Name           string  `json:"name" binding:"required"`
-	Model          string  `json:"model"`
-	AvgDataRate    float64 `json:"avg_data_rate"`
-	DataPerHour    float64 `json:"data_per_hour"`
-	NamespaceURL   string  `json:"namespace_url"`
-	Description    string  `json:"description"`
-	DescriptionAll string  `json:"description_all"`
-	Protocol       string  `json:"protocol"`
+	Name           string  `json:"name" validate:"required,max=200"`
+	Model          string  `json:"model" validate:"max=100"`
+	AvgDataRate    float64 `json:"avg_data_rate" validate:"min=0,max=1000000"`
+	DataPerHour    float64 `json:"data_per_hour" validate:"min=0,max=1000000"`
+	NamespaceURL   string  `json:"namespace_url" validate:"omitempty,url,max=500"`
+	Description    string  `json:"description" validate:"max=1000"`
+	DescriptionAll string  `json:"description_all" validate:"max=10000"`
+	Protocol       string  `json:"protocol" validate:"omitempty,oneof=Wi-Fi Zigbee Bluetooth Z-Wave Thread Matter"`
+	DeviceTypeID   *uint   `json:"device_type_id"` // без типа коэффициент трафика 1.0
+}
+
+// SmartDeviceUpdateRequest - тело PUT /api/smart-devices/{id}. namespace_url здесь нет:
+// это URL главной картинки галереи, он меняется через /image и /images.
+type SmartDeviceUpdateRequest struct {
+	Name           string     `json:"name" validate:"required,max=200"`
+	Model          string     `json:"model" validate:"max=100"`
+	AvgDataRate    float64    `json:"avg_data_rate" validate:"min=0,max=1000000"`
+	DataPerHour    float64    `json:"data_per_hour" validate:"min=0,max=1000000"`
+	Description    string     `json:"description" validate:"max=1000"`
+	DescriptionAll string     `json:"description_all" validate:"max=10000"`
+	Protocol       string     `json:"protocol" validate:"omitempty,oneof=Wi-Fi Zigbee Bluetooth Z-Wave Thread Matter"`
+	DeviceTypeID   OptionalID `json:"device_type_id"` // нет в теле - тип не меняется, null - тип снимается
+}
+
+// OptionalID - ID, для которого важно, было ли поле в JSON:
+// Set = false - поля нет, Set = true и Value = nil - передан null
+type OptionalID struct {
+	Set   bool
+	Value *uint
+}
+
+func (o *OptionalID) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
 }
 
 func SmartDeviceToJSON(device models.SmartDevice) SmartDeviceResponse {
-	return SmartDeviceResponse{
+	response := SmartDeviceResponse{
 		ID:             device.ID,
 		Name:           device.Name,
 		Model:          device.Model,
@@ -43,5 +84,11 @@ func SmartDeviceToJSON(device models.SmartDevice) SmartDeviceResponse {
 		Protocol:       device.Protocol,
 		IsActive:       device.IsActive,
 		CreatedAt:      device.CreatedAt,
+		DeviceTypeID:   device.DeviceTypeID,
+	}
+	if device.DeviceType != nil {
+		deviceType := DeviceTypeToJSON(*device.DeviceType)
+		response.DeviceType = &deviceType
 	}
+	return response
 }
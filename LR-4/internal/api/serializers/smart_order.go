@@ -1,8 +1,11 @@
 package serializers
 
 import (
-	"smartdevices/internal/models"
 	"time"
+
+	"smartdevices/internal/compat"
+	"smartdevices/internal/models"
+	"smartdevices/internal/traffic"
 )
 
 type SmartOrderResponse struct {
@@ -16,8 +19,12 @@ type SmartOrderResponse struct {
 	CompletedAt   *time.Time               `json:"completed_at,omitempty"`
 	ModeratorID   *uint                    `json:"moderator_id,omitempty"`
 	ModeratorName string                   `json:"moderator_name,omitempty"`
+	RejectReason  string                   `json:"reject_reason,omitempty"`
 	CreatedAt     time.Time                `json:"created_at"`
 	Items         []SmartOrderItemResponse `json:"items"`
+
+	// Расшифровка общего трафика по позициям (только для одной заявки)
+	Traffic *traffic.Breakdown `json:"traffic,omitempty"`
 }
 
 type SmartOrderItemResponse struct {
@@ -29,7 +36,11 @@ type SmartOrderItemResponse struct {
 }
 
 type SmartOrderUpdateRequest struct {
-	Address string `json:"address"`
+	Address string `json:"address" validate:"max=500"`
+}
+
+type SmartOrderRejectRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
 }
 
 type SmartOrderFilter struct {
@@ -49,6 +60,7 @@ func SmartOrderToJSON(order models.SmartOrder, items []SmartOrderItemResponse) S
 		FormedAt:     order.FormedAt,
 		CompletedAt:  order.CompletedAt,
 		ModeratorID:  order.ModeratorID,
+		RejectReason: order.RejectReason,
 		CreatedAt:    order.CreatedAt,
 		Items:        items,
 	}
@@ -59,3 +71,52 @@ func SmartOrderToJSON(order models.SmartOrder, items []SmartOrderItemResponse) S
 
 	return response
 }
+
+type OrderEventResponse struct {
+	ID        uint      `json:"id"`
+	Type      string    `json:"type"`
+	Field     string    `json:"field"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	ActorID   uint      `json:"actor_id"`
+	ActorName string    `json:"actor_name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func OrderEventToJSON(event models.OrderEvent) OrderEventResponse {
+	return OrderEventResponse{
+		ID:        event.ID,
+		Type:      event.Type,
+		Field:     event.Field,
+		OldValue:  event.OldValue,
+		NewValue:  event.NewValue,
+		ActorID:   event.ActorID,
+		ActorName: event.Actor.Username,
+		CreatedAt: event.CreatedAt,
+	}
+}
+
+// TrafficPreviewResponse - прогноз трафика заявки или корзины
+type TrafficPreviewResponse struct {
+	OrderID   uint              `json:"order_id"` // 0 - корзина пуста
+	Status    string            `json:"status"`
+	Live      bool              `json:"live"` // false - значения сохранены при завершении заявки
+	Breakdown traffic.Breakdown `json:"breakdown"`
+	Estimate  traffic.Estimate  `json:"estimate"`
+}
+
+func TrafficPreviewToJSON(order models.SmartOrder, breakdown traffic.Breakdown) TrafficPreviewResponse {
+	return TrafficPreviewResponse{
+		OrderID:   order.ID,
+		Status:    order.Status,
+		Live:      breakdown.Method != traffic.MethodRecorded,
+		Breakdown: breakdown,
+		Estimate:  traffic.EstimateOf(breakdown),
+	}
+}
+
+// CompatibilityResponse - результат проверки совместимости устройств заявки
+type CompatibilityResponse struct {
+	OrderID uint `json:"order_id"` // 0 - корзина пуста
+	compat.Report
+}
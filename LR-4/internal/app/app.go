@@ -0,0 +1,207 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+
+	apiHandlers "smartdevices/internal/api/handlers"
+	"smartdevices/internal/compat"
+	"smartdevices/internal/config"
+	"smartdevices/internal/handlers"
+	"smartdevices/internal/images"
+	"smartdevices/internal/middleware"
+	"smartdevices/internal/session"
+	"smartdevices/internal/storage"
+	"smartdevices/internal/traffic"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// App - контейнер зависимостей приложения. Все соединения (БД, хранилище сессий,
+// объектное хранилище) создаются один раз при старте и закрываются в Close.
+type App struct {
+	Config   config.Config
+	DB       *gorm.DB
+	Sessions *session.Manager
+	Storage  storage.ObjectStore
+	Auth     *middleware.AuthMiddleware
+	Traffic  traffic.Calculator
+	Compat   *compat.Engine
+
+	SmartDeviceAPI *apiHandlers.SmartDeviceAPIHandler
+	DeviceTypeAPI  *apiHandlers.DeviceTypeAPIHandler
+	SmartOrderAPI  *apiHandlers.SmartOrderAPIHandler
+	OrderItemAPI   *apiHandlers.OrderItemAPIHandler
+	ClientAPI      *apiHandlers.ClientAPIHandler
+}
+
+// Option позволяет подменить компонент (например, в тестах)
+type Option func(*App)
+
+// WithDB использует готовое подключение к БД
+func WithDB(db *gorm.DB) Option {
+	return func(a *App) { a.DB = db }
+}
+
+// WithSessionStore использует заданное хранилище сессий
+func WithSessionStore(store session.Store) Option {
+	return func(a *App) { a.Sessions = session.NewManager(store) }
+}
+
+// WithStorage использует заданное объектное хранилище
+func WithStorage(s storage.ObjectStore) Option {
+	return func(a *App) { a.Storage = s }
+}
+
+// WithTrafficCalculator заменяет алгоритм расчета трафика заявок
+func WithTrafficCalculator(c traffic.Calculator) Option {
+	return func(a *App) { a.Traffic = c }
+}
+
+// WithCompatibilityRules заменяет правила совместимости устройств
+func WithCompatibilityRules(rules compat.Rules) Option {
+	return func(a *App) { a.Compat = compat.New(rules) }
+}
+
+// New создает приложение и все его зависимости
+func New(cfg config.Config, opts ...Option) (*App, error) {
+	a := &App{Config: cfg}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	// Соединения, открытые здесь, закрываются при ошибке следующего шага;
+	// переданные через Option закрывает вызывающий код
+	var opened []func() error
+	fail := func(step string, err error) (*App, error) {
+		for i := len(opened) - 1; i >= 0; i-- {
+			if cerr := opened[i](); cerr != nil {
+				log.Printf("⚠️ Failed to close connection: %v", cerr)
+			}
+		}
+		return nil, fmt.Errorf("%s: %w", step, err)
+	}
+
+	// Подключение к PostgreSQL через GORM
+	if a.DB == nil {
+		// TranslateError: нарушение уникальности приходит как gorm.ErrDuplicatedKey
+		db, err := gorm.Open(postgres.Open(cfg.Database.DSN), &gorm.Config{TranslateError: true})
+		if err != nil {
+			return fail("database", err)
+		}
+		a.DB = db
+		if sqlDB, err := db.DB(); err == nil {
+			opened = append(opened, sqlDB.Close)
+		}
+	}
+
+	if a.Sessions == nil {
+		a.Sessions = session.NewSessionManager(cfg)
+		opened = append(opened, a.Sessions.Close)
+	}
+
+	if a.Storage == nil {
+		store, err := storage.New(cfg)
+		if err != nil {
+			return fail("object storage", err)
+		}
+		a.Storage = store
+	}
+
+	if a.Traffic == nil {
+		a.Traffic = traffic.CoefficientCalculator{}
+	}
+
+	if a.Compat == nil {
+		a.Compat = compat.New(compat.DefaultRules)
+	}
+
+	a.Auth = middleware.NewAuthMiddlewareWithSessions(a.DB, cfg, a.Sessions)
+
+	// Инициализация HTML handlers с передачей DB
+	handlers.Init(a.DB, a.Traffic, a.Compat, a.Storage)
+
+	// Инициализация API handlers
+	a.SmartDeviceAPI = apiHandlers.NewSmartDeviceAPIHandler(a.DB, a.Auth, a.Storage, images.Limits{
+		MaxBytes:     cfg.Storage.MaxUploadSize,
+		MaxDimension: cfg.Storage.MaxImageDimension,
+	})
+	a.DeviceTypeAPI = apiHandlers.NewDeviceTypeAPIHandler(a.DB, a.Auth)
+	a.SmartOrderAPI = apiHandlers.NewSmartOrderAPIHandler(a.DB, a.Auth, a.Traffic, a.Compat)
+	a.OrderItemAPI = apiHandlers.NewOrderItemAPIHandler(a.DB, a.Auth)
+	a.ClientAPI = apiHandlers.NewClientAPIHandler(a.DB, a.Auth)
+
+	return a, nil
+}
+
+// Run запускает HTTP сервер и блокируется до SIGINT/SIGTERM.
+// При остановке сервер перестает принимать соединения и ждет завершения
+// текущих запросов не дольше server.shutdown_timeout.
+func (a *App) Run() error {
+	srv := &http.Server{
+		Addr:              a.Config.Server.Addr,
+		Handler:           a.Handler(),
+		ReadTimeout:       a.Config.Server.ReadTimeout,
+		ReadHeaderTimeout: a.Config.Server.ReadTimeout,
+		WriteTimeout:      a.Config.Server.WriteTimeout,
+		IdleTimeout:       a.Config.Server.IdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logRoutes(a.Config)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	log.Println("🛑 Получен сигнал остановки, ждем завершения запросов...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.Config.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	log.Println("✅ Сервер остановлен")
+	return nil
+}
+
+// Close освобождает соединения с БД, хранилищем сессий и объектным хранилищем
+func (a *App) Close() error {
+	var errs []error
+
+	if a.Sessions != nil {
+		errs = append(errs, a.Sessions.Close())
+	}
+
+	if a.Storage != nil {
+		errs = append(errs, a.Storage.Close())
+	}
+
+	if a.DB != nil {
+		if sqlDB, err := a.DB.DB(); err == nil {
+			errs = append(errs, sqlDB.Close())
+		}
+	}
+
+	log.Println("👋 Соединения закрыты")
+	return errors.Join(errs...)
+}
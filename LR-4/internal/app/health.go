@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// readinessTimeout - сколько ждать ответа каждой зависимости
+const readinessTimeout = 2 * time.Second
+
+// dependencyStatus - состояние одной зависимости в ответе /readyz
+type dependencyStatus struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// GET /healthz - процесс жив
+func (a *App) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "ok",
+	})
+}
+
+// GET /readyz - готовность принимать трафик: Postgres, хранилище сессий и объектное хранилище
+func (a *App) Readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]func(ctx context.Context) error{
+		"postgres": func(ctx context.Context) error {
+			sqlDB, err := a.DB.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		},
+		"sessions": a.Sessions.Ping,
+		"storage":  a.Storage.Ping,
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]dependencyStatus, len(checks))
+		ready   = true
+	)
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(ctx)
+			status := dependencyStatus{Status: "ok", Latency: time.Since(start).String()}
+			if err != nil {
+				status.Status = "fail"
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[name] = status
+			if err != nil {
+				ready = false
+			}
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	response := map[string]interface{}{
+		"status":       "ok",
+		"dependencies": results,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		response["status"] = "fail"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
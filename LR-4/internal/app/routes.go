@@ -0,0 +1,203 @@
+package app
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"smartdevices/internal/apperr"
+	"smartdevices/internal/config"
+	"smartdevices/internal/handlers"
+	"smartdevices/internal/middleware"
+	"smartdevices/internal/router"
+	"smartdevices/internal/storage"
+)
+
+// Handler собирает все маршруты приложения
+func (a *App) Handler() http.Handler {
+	r := router.New()
+	r.Wrap(middleware.CORS(a.Config.CORS))
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			apperr.Write(w, r, apperr.NotFound("Route not found"))
+			return
+		}
+		handlers.Show404Page(w, "Страница не найдена")
+	})
+
+	// Проверки состояния для оркестратора / балансировщика
+	r.Get("/healthz", a.Healthz)
+	r.Get("/readyz", a.Readyz)
+
+	// Статические файлы
+	r.Mount("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+
+	// Файлы локального хранилища (storage.backend = local)
+	if local, ok := a.Storage.(*storage.LocalStore); ok {
+		r.Mount(local.MountPath(), local.Handler())
+	}
+
+	// Главная страница - сразу показываем устройства
+	r.Get("/{$}", handlers.SmartDevicesHandler)
+
+	// HTML маршруты
+	r.Get("/smart-devices", handlers.SmartDevicesHandler)
+	r.Get("/smart-devices/{id}", handlers.SmartDeviceDetailHandler)
+	r.Get("/smart-cart", handlers.SmartCartHandler)
+	r.Post("/smart-cart/add", handlers.AddToSmartCartHandler)
+	r.Post("/smart-cart/delete", handlers.DeleteSmartCartHandler)
+	r.Get("/smart-cart/count", handlers.GetSmartCartCountHandler)
+	r.Get("/request/{id}", handlers.RequestByIDHandler)
+
+	api := r.Group("/api")
+	authed := api.With(a.Auth.RequireAuth)
+	moderator := api.With(a.Auth.RequireModerator)
+
+	// API маршруты аутентификации
+	api.Post("/auth/login", a.Auth.Login)
+	api.Post("/auth/logout", a.Auth.Logout)
+	api.Get("/auth/session", a.Auth.GetSessionInfo)
+	moderator.Get("/auth/sessions", a.Auth.GetAllSessions)
+	authed.Get("/auth/my-sessions", a.Auth.GetMySessions)
+	authed.Delete("/auth/my-sessions/{id}", a.Auth.RevokeMySession)
+	authed.Post("/auth/logout-all", a.Auth.LogoutAll)
+
+	// НОВЫЕ LUA-ENDPOINTS для отображения пользователей
+	moderator.Get("/auth/users-info", a.Auth.GetUsersInfo)
+	moderator.Get("/auth/session-stats", a.Auth.GetSessionStats)
+
+	// API маршруты - Smart Devices
+	api.Get("/smart-devices", a.SmartDeviceAPI.GetSmartDevices)
+	api.Get("/smart-devices/suggest", a.SmartDeviceAPI.SuggestSmartDevices)
+	api.Get("/smart-devices/{id}", a.SmartDeviceAPI.GetSmartDevice)
+	moderator.Post("/smart-devices", a.SmartDeviceAPI.CreateSmartDevice)
+	moderator.Put("/smart-devices/{id}", a.SmartDeviceAPI.UpdateSmartDevice)
+	moderator.Delete("/smart-devices/{id}", a.SmartDeviceAPI.DeleteSmartDevice)
+	moderator.Post("/smart-devices/{id}/image", a.SmartDeviceAPI.UploadDeviceImage)
+	moderator.Delete("/smart-devices/{id}/image", a.SmartDeviceAPI.DeleteDeviceImage)
+	api.Get("/smart-devices/{id}/images", a.SmartDeviceAPI.GetDeviceImages)
+	moderator.Post("/smart-devices/{id}/images", a.SmartDeviceAPI.AddDeviceImage)
+	moderator.Put("/smart-devices/{id}/images/order", a.SmartDeviceAPI.ReorderDeviceImages)
+	moderator.Put("/smart-devices/{id}/images/{imageId}", a.SmartDeviceAPI.UpdateDeviceImage)
+	moderator.Put("/smart-devices/{id}/images/{imageId}/primary", a.SmartDeviceAPI.SetPrimaryDeviceImage)
+	moderator.Delete("/smart-devices/{id}/images/{imageId}", a.SmartDeviceAPI.DeleteGalleryImage)
+	authed.Post("/smart-devices/{id}/draft", a.SmartDeviceAPI.AddDeviceToDraft)
+
+	// API маршруты - Device Types
+	api.Get("/device-types", a.DeviceTypeAPI.GetDeviceTypes)
+	api.Get("/device-types/{id}", a.DeviceTypeAPI.GetDeviceType)
+	moderator.Post("/device-types", a.DeviceTypeAPI.CreateDeviceType)
+	moderator.Put("/device-types/{id}", a.DeviceTypeAPI.UpdateDeviceType)
+	moderator.Delete("/device-types/{id}", a.DeviceTypeAPI.DeleteDeviceType)
+
+	// API маршруты - Smart Orders
+	authed.Get("/smart-orders/cart", a.SmartOrderAPI.GetCart)
+	authed.Get("/smart-orders/cart/traffic", a.SmartOrderAPI.GetCartTraffic)
+	authed.Get("/smart-orders/cart/compatibility", a.SmartOrderAPI.GetCartCompatibility)
+	authed.Get("/smart-orders", a.SmartOrderAPI.GetSmartOrders)
+	authed.Get("/smart-orders/{id}", a.SmartOrderAPI.GetSmartOrder)
+	authed.Put("/smart-orders/{id}", a.SmartOrderAPI.UpdateSmartOrder)
+	authed.Delete("/smart-orders/{id}", a.SmartOrderAPI.DeleteSmartOrder)
+	authed.Put("/smart-orders/{id}/form", a.SmartOrderAPI.FormSmartOrder)
+	authed.Get("/smart-orders/{id}/history", a.SmartOrderAPI.GetSmartOrderHistory)
+	authed.Get("/smart-orders/{id}/traffic", a.SmartOrderAPI.GetSmartOrderTraffic)
+	authed.Get("/smart-orders/{id}/compatibility", a.SmartOrderAPI.GetSmartOrderCompatibility)
+	moderator.Put("/smart-orders/{id}/complete", a.SmartOrderAPI.CompleteSmartOrder)
+	moderator.Put("/smart-orders/{id}/reject", a.SmartOrderAPI.RejectSmartOrder)
+
+	// API маршруты - Order Items
+	authed.Put("/order-items/{deviceId}", a.OrderItemAPI.UpdateOrderItem)
+	authed.Delete("/order-items/{deviceId}", a.OrderItemAPI.DeleteOrderItem)
+
+	// API маршруты - Clients
+	api.Post("/clients/login", a.ClientAPI.Login)
+	api.Post("/clients/logout", a.ClientAPI.Logout)
+	api.Post("/clients/register", a.ClientAPI.CreateClient)
+	authed.Put("/clients/update", a.ClientAPI.UpdateClient)
+	moderator.Get("/clients", a.ClientAPI.GetClients)
+	moderator.Get("/clients/{id}", a.ClientAPI.GetClient)
+	moderator.Delete("/clients/{id}/sessions", a.ClientAPI.ForceLogoutClient)
+
+	return r.Handler()
+}
+
+// logRoutes выводит список доступных методов при старте
+func logRoutes(cfg config.Config) {
+	log.Printf("🚀 Сервер запущен на %s", cfg.Server.Addr)
+	log.Println("📱 HTML интерфейс доступен")
+	log.Println("🔐 Auth system initialized")
+	log.Printf("🍪 Session storage: %s", cfg.Session.Store)
+	log.Println("👥 User roles: client/moderator")
+	log.Println("🔮 Redis Lua scripts enabled")
+	log.Printf("🗄️ Object storage: %s", cfg.Storage.Backend)
+	log.Printf("🌐 CORS origins: %s", strings.Join(cfg.CORS.AllowedOrigins, ", "))
+
+	log.Println("🩺 Health:")
+	log.Println("   GET    /healthz                     - процесс жив")
+	log.Println("   GET    /readyz                      - готовность: Postgres, сессии, хранилище")
+
+	log.Println("🔐 Auth API:")
+	log.Println("   POST   /api/auth/login              - аутентификация")
+	log.Println("   POST   /api/auth/logout             - выход")
+	log.Println("   GET    /api/auth/session            - информация о сессии")
+	log.Println("   GET    /api/auth/sessions           - все сессии (модератор)")
+	log.Println("   GET    /api/auth/my-sessions        - мои сессии (требует auth)")
+	log.Println("   DELETE /api/auth/my-sessions/{id}   - завершить свою сессию (требует auth)")
+	log.Println("   POST   /api/auth/logout-all         - выход на всех устройствах (требует auth)")
+	log.Println("   GET    /api/auth/users-info         - пользователи через Lua (модератор)")
+	log.Println("   GET    /api/auth/session-stats      - статистика сессий через Lua (модератор)")
+
+	log.Println("📦 Smart Devices API:")
+	log.Println("   GET    /api/smart-devices           - список устройств")
+	log.Println("   GET    /api/smart-devices/suggest   - автодополнение поиска")
+	log.Println("   GET    /api/smart-devices/{id}      - устройство по ID")
+	log.Println("   POST   /api/smart-devices           - создать устройство (модератор)")
+	log.Println("   PUT    /api/smart-devices/{id}      - обновить устройство (модератор)")
+	log.Println("   DELETE /api/smart-devices/{id}      - удалить устройство (модератор)")
+	log.Println("   POST   /api/smart-devices/{id}/image - заменить главную картинку (модератор)")
+	log.Println("   DELETE /api/smart-devices/{id}/image - удалить главную картинку (модератор)")
+	log.Println("   GET    /api/smart-devices/{id}/images - галерея устройства")
+	log.Println("   POST   /api/smart-devices/{id}/images - добавить картинку в галерею (модератор)")
+	log.Println("   PUT    /api/smart-devices/{id}/images/order - порядок галереи (модератор)")
+	log.Println("   PUT    /api/smart-devices/{id}/images/{imageId} - подпись картинки (модератор)")
+	log.Println("   PUT    /api/smart-devices/{id}/images/{imageId}/primary - сделать главной (модератор)")
+	log.Println("   DELETE /api/smart-devices/{id}/images/{imageId} - удалить из галереи (модератор)")
+	log.Println("   POST   /api/smart-devices/{id}/draft - добавить в заявку-черновик (требует auth)")
+
+	log.Println("🏷️ Device Types API:")
+	log.Println("   GET    /api/device-types            - типы устройств")
+	log.Println("   GET    /api/device-types/{id}       - тип по ID")
+	log.Println("   POST   /api/device-types            - создать тип (модератор)")
+	log.Println("   PUT    /api/device-types/{id}       - изменить тип и коэффициент (модератор)")
+	log.Println("   DELETE /api/device-types/{id}       - удалить неиспользуемый тип (модератор)")
+
+	log.Println("📋 Smart Orders API:")
+	log.Println("   GET    /api/smart-orders/cart       - корзина (требует auth)")
+	log.Println("   GET    /api/smart-orders/cart/traffic - прогноз трафика корзины (требует auth)")
+	log.Println("   GET    /api/smart-orders/cart/compatibility - совместимость устройств корзины (требует auth)")
+	log.Println("   GET    /api/smart-orders            - список заявок (требует auth)")
+	log.Println("   GET    /api/smart-orders/{id}       - заявка по ID (требует auth)")
+	log.Println("   PUT    /api/smart-orders/{id}       - обновить заявку (требует auth)")
+	log.Println("   PUT    /api/smart-orders/{id}/form  - сформировать заявку с проверкой совместимости (требует auth)")
+	log.Println("   PUT    /api/smart-orders/{id}/complete - завершить заявку (модератор)")
+	log.Println("   PUT    /api/smart-orders/{id}/reject - отклонить заявку (модератор)")
+	log.Println("   GET    /api/smart-orders/{id}/history - история изменений (требует auth)")
+	log.Println("   GET    /api/smart-orders/{id}/traffic - прогноз трафика: час/сутки/месяц, пик (требует auth)")
+	log.Println("   GET    /api/smart-orders/{id}/compatibility - совместимость устройств (требует auth)")
+	log.Println("   DELETE /api/smart-orders/{id}       - удалить заявку (требует auth)")
+
+	log.Println("🛒 Order Items API:")
+	log.Println("   PUT    /api/order-items/{deviceId}  - изменить количество (требует auth)")
+	log.Println("   DELETE /api/order-items/{deviceId}  - удалить из заявки (требует auth)")
+
+	log.Println("👥 Clients API:")
+	log.Println("   GET    /api/clients                 - список клиентов (модератор)")
+	log.Println("   GET    /api/clients/{id}            - клиент по ID (модератор)")
+	log.Println("   DELETE /api/clients/{id}/sessions   - принудительный выход клиента (модератор)")
+	log.Println("   POST   /api/clients/register        - регистрация")
+	log.Println("   PUT    /api/clients/update          - обновить данные (требует auth)")
+	log.Println("   POST   /api/clients/login           - аутентификация")
+	log.Println("   POST   /api/clients/logout          - деавторизация")
+
+	log.Println("🎯 Всего методов: 51")
+}
@@ -0,0 +1,174 @@
+package apperr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"smartdevices/internal/orderstate"
+
+	"gorm.io/gorm"
+)
+
+// Code - стабильный машиночитаемый код ошибки. Клиенты опираются на него,
+// а не на текст, поэтому существующие значения не переименовываются.
+type Code string
+
+const (
+	CodeBadRequest         Code = "bad_request"
+	CodeInvalidBody        Code = "invalid_body"
+	CodeInvalidParameter   Code = "invalid_parameter"
+	CodeValidation         Code = "validation_failed"
+	CodeUnauthorized       Code = "unauthorized"
+	CodeInvalidCredentials Code = "invalid_credentials"
+	CodeForbidden          Code = "forbidden"
+	CodeNotFound           Code = "not_found"
+	CodeConflict           Code = "conflict"
+	CodeInvalidTransition  Code = "invalid_transition"
+	CodeIncompatible       Code = "incompatible_devices"
+	CodeUnsupportedMedia   Code = "unsupported_media_type"
+	CodeInternal           Code = "internal"
+)
+
+// FieldError - ошибка конкретного поля запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"` // required, min, max, ...
+	Message string `json:"message"`
+}
+
+// Error - ошибка API: HTTP-статус, код и текст для клиента.
+// Причина (Err) пишется в лог и наружу не отдается.
+type Error struct {
+	Status int
+	Code   Code
+	Detail string
+	Fields []FieldError
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Detail)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(status int, code Code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// Wrap сохраняет исходную ошибку как причину
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+func BadRequest(detail string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, detail)
+}
+
+// InvalidBody - тело запроса не разобралось как JSON
+func InvalidBody(err error) *Error {
+	return New(http.StatusBadRequest, CodeInvalidBody, "Invalid request body").Wrap(err)
+}
+
+// InvalidParam - некорректный параметр пути или запроса
+func InvalidParam(name string, err error) *Error {
+	e := New(http.StatusBadRequest, CodeInvalidParameter, "Invalid parameter: "+name).Wrap(err)
+	e.Fields = []FieldError{{Field: name, Code: "invalid", Message: "Invalid value"}}
+	return e
+}
+
+// Validation - ошибки валидации по полям
+func Validation(fields ...FieldError) *Error {
+	e := New(http.StatusBadRequest, CodeValidation, "Request validation failed")
+	e.Fields = fields
+	return e
+}
+
+func Unauthorized(detail string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, detail)
+}
+
+func InvalidCredentials() *Error {
+	return New(http.StatusUnauthorized, CodeInvalidCredentials, "Invalid credentials")
+}
+
+func Forbidden(detail string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, detail)
+}
+
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+func Conflict(detail string) *Error {
+	return New(http.StatusConflict, CodeConflict, detail)
+}
+
+// Internal - непредвиденная ошибка; клиент получает общий текст
+func Internal(err error) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, "Internal server error").Wrap(err)
+}
+
+// From приводит произвольную ошибку к *Error, распознавая доменные ошибки
+func From(err error) *Error {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return NotFound("Resource not found").Wrap(err)
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return Conflict("Resource already exists").Wrap(err)
+	case errors.Is(err, orderstate.ErrForbidden):
+		return Forbidden("Action is not allowed for this user").Wrap(err)
+	case errors.Is(err, orderstate.ErrInvalidTransition):
+		return New(http.StatusConflict, CodeInvalidTransition, err.Error()).Wrap(err)
+	case errors.Is(err, orderstate.ErrConflict):
+		return Conflict("Order was changed by another request, reload and retry").Wrap(err)
+	case errors.Is(err, orderstate.ErrUnknownAction):
+		return BadRequest(err.Error()).Wrap(err)
+	default:
+		return Internal(err)
+	}
+}
+
+// Problem - тело ответа application/problem+json (RFC 7807)
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     Code         `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// Write отправляет ошибку клиенту в формате problem details
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	e := From(err)
+	if e.Status >= http.StatusInternalServerError {
+		log.Printf("❌ %s %s: %v", r.Method, r.URL.Path, e)
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(e.Status),
+		Status:   e.Status,
+		Detail:   e.Detail,
+		Instance: r.URL.Path,
+		Code:     e.Code,
+		Errors:   e.Fields,
+	})
+}
@@ -0,0 +1,292 @@
+package compat
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// HubTypeCode - код типа устройства, которое работает шлюзом для остальных
+const HubTypeCode = "hub"
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // заявку нельзя сформировать
+	SeverityWarning Severity = "warning" // можно, но стоит проверить
+)
+
+// Коды проблем стабильны: клиенты опираются на них
+const (
+	CodeMissingGateway  = "missing_gateway"
+	CodeHubCapacity     = "hub_capacity"
+	CodeHubNearCapacity = "hub_near_capacity"
+	CodeUnusedHub       = "unused_hub"
+	CodeUnknownProtocol = "unknown_protocol"
+)
+
+// Line - позиция заявки (устройство с загруженным DeviceType)
+type Line struct {
+	Device   models.SmartDevice
+	Quantity int
+}
+
+// Suggestion - устройство, которое стоит добавить в заявку
+type Suggestion struct {
+	DeviceID uint   `json:"device_id"`
+	Name     string `json:"name"`
+	Model    string `json:"model"`
+	Protocol string `json:"protocol"`
+}
+
+// Issue - найденная проблема совместимости
+type Issue struct {
+	Code        string       `json:"code"`
+	Severity    Severity     `json:"severity"`
+	Message     string       `json:"message"`
+	Protocol    string       `json:"protocol,omitempty"`
+	DeviceIDs   []uint       `json:"device_ids,omitempty"`
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+}
+
+// Report - результат проверки: OK = нет блокирующих ошибок
+type Report struct {
+	OK       bool    `json:"ok"`
+	Errors   []Issue `json:"errors"`
+	Warnings []Issue `json:"warnings"`
+}
+
+// Rules - знания о протоколах и шлюзах
+type Rules struct {
+	// Протоколы, устройствам которых нужен шлюз (хаб) в той же заявке
+	NeedsGateway []string
+	// Какие протоколы дочерних устройств хаб пробрасывает, по протоколу самого хаба
+	Bridges map[string][]string
+	// Сколько дочерних устройств поддерживает один хаб
+	HubCapacity int
+	// Доля емкости, начиная с которой выдается предупреждение
+	WarnAt float64
+}
+
+// DefaultRules - правила для протоколов каталога (devicefilter.Protocols)
+var DefaultRules = Rules{
+	NeedsGateway: []string{"Zigbee", "Z-Wave", "Thread", "Bluetooth"},
+	Bridges: map[string][]string{
+		"Wi-Fi":  {"Zigbee", "Bluetooth"},
+		"Matter": {"Thread", "Zigbee"},
+		"Zigbee": {"Zigbee"},
+		"Z-Wave": {"Z-Wave"},
+		"Thread": {"Thread"},
+	},
+	HubCapacity: 32,
+	WarnAt:      0.8,
+}
+
+// check - одна проверка состава заявки
+type check func(e *Engine, o order) []Issue
+
+// Engine проверяет заявку набором правил. Хабы из каталога нужны для подсказок.
+type Engine struct {
+	Rules  Rules
+	checks []check
+}
+
+// New создает движок со стандартным набором проверок
+func New(rules Rules) *Engine {
+	return &Engine{
+		Rules:  rules,
+		checks: []check{checkUnknownProtocol, checkGateways, checkUnusedHubs},
+	}
+}
+
+// order - позиции заявки, разложенные для проверок
+type order struct {
+	hubs     []Line
+	children map[string][]Line // по протоколу, только для протоколов, которым нужен шлюз
+	other    []Line
+	catalog  []models.SmartDevice // активные хабы каталога
+}
+
+// Check проверяет состав заявки. catalog - активные хабы для подсказок (см. LoadHubs).
+func (e *Engine) Check(lines []Line, catalog []models.SmartDevice) Report {
+	o := order{children: map[string][]Line{}, catalog: catalog}
+	for _, l := range lines {
+		switch {
+		case isHub(l.Device):
+			o.hubs = append(o.hubs, l)
+		case slices.Contains(e.Rules.NeedsGateway, l.Device.Protocol):
+			o.children[l.Device.Protocol] = append(o.children[l.Device.Protocol], l)
+		default:
+			o.other = append(o.other, l)
+		}
+	}
+
+	report := Report{Errors: []Issue{}, Warnings: []Issue{}}
+	for _, check := range e.checks {
+		for _, issue := range check(e, o) {
+			if issue.Severity == SeverityError {
+				report.Errors = append(report.Errors, issue)
+			} else {
+				report.Warnings = append(report.Warnings, issue)
+			}
+		}
+	}
+	report.OK = len(report.Errors) == 0
+	return report
+}
+
+// checkGateways - для каждого протокола, которому нужен шлюз, в заявке должны быть
+// хабы, пробрасывающие этот протокол, и их суммарной емкости должно хватать
+func checkGateways(e *Engine, o order) []Issue {
+	var issues []Issue
+	for _, protocol := range sortedKeys(o.children) {
+		children := o.children[protocol]
+		count := quantity(children)
+
+		capacity := 0
+		for _, hub := range o.hubs {
+			if e.bridges(hub.Device, protocol) {
+				capacity += hub.Quantity * e.Rules.HubCapacity
+			}
+		}
+
+		switch {
+		case capacity == 0:
+			issues = append(issues, Issue{
+				Code:        CodeMissingGateway,
+				Severity:    SeverityError,
+				Message:     fmt.Sprintf("%s devices need a hub that supports %s", protocol, protocol),
+				Protocol:    protocol,
+				DeviceIDs:   deviceIDs(children),
+				Suggestions: e.suggestHubs(o.catalog, protocol),
+			})
+		case count > capacity:
+			issues = append(issues, Issue{
+				Code:        CodeHubCapacity,
+				Severity:    SeverityError,
+				Message:     fmt.Sprintf("%d %s devices exceed hub capacity of %d", count, protocol, capacity),
+				Protocol:    protocol,
+				DeviceIDs:   deviceIDs(children),
+				Suggestions: e.suggestHubs(o.catalog, protocol),
+			})
+		case float64(count) >= float64(capacity)*e.Rules.WarnAt:
+			issues = append(issues, Issue{
+				Code:      CodeHubNearCapacity,
+				Severity:  SeverityWarning,
+				Message:   fmt.Sprintf("%d of %d %s hub slots used", count, capacity, protocol),
+				Protocol:  protocol,
+				DeviceIDs: deviceIDs(children),
+			})
+		}
+	}
+	return issues
+}
+
+// checkUnusedHubs - хаб, к которому нечего подключить
+func checkUnusedHubs(e *Engine, o order) []Issue {
+	var issues []Issue
+	for _, hub := range o.hubs {
+		used := false
+		for protocol := range o.children {
+			if e.bridges(hub.Device, protocol) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			issues = append(issues, Issue{
+				Code:      CodeUnusedHub,
+				Severity:  SeverityWarning,
+				Message:   fmt.Sprintf("%s has no devices to connect in this order", hub.Device.Name),
+				DeviceIDs: []uint{hub.Device.ID},
+			})
+		}
+	}
+	return issues
+}
+
+// checkUnknownProtocol - у устройства не указан протокол, совместимость не проверить
+func checkUnknownProtocol(e *Engine, o order) []Issue {
+	var ids []uint
+	for _, l := range o.other {
+		if strings.TrimSpace(l.Device.Protocol) == "" {
+			ids = append(ids, l.Device.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return []Issue{{
+		Code:      CodeUnknownProtocol,
+		Severity:  SeverityWarning,
+		Message:   "Protocol is not specified, compatibility cannot be checked",
+		DeviceIDs: ids,
+	}}
+}
+
+func (e *Engine) bridges(hub models.SmartDevice, protocol string) bool {
+	return slices.Contains(e.Rules.Bridges[hub.Protocol], protocol)
+}
+
+func (e *Engine) suggestHubs(catalog []models.SmartDevice, protocol string) []Suggestion {
+	var suggestions []Suggestion
+	for _, d := range catalog {
+		if isHub(d) && e.bridges(d, protocol) {
+			suggestions = append(suggestions, Suggestion{DeviceID: d.ID, Name: d.Name, Model: d.Model, Protocol: d.Protocol})
+		}
+	}
+	return suggestions
+}
+
+func isHub(d models.SmartDevice) bool {
+	return d.DeviceType != nil && d.DeviceType.Code == HubTypeCode
+}
+
+func quantity(lines []Line) int {
+	n := 0
+	for _, l := range lines {
+		n += l.Quantity
+	}
+	return n
+}
+
+func deviceIDs(lines []Line) []uint {
+	ids := make([]uint, 0, len(lines))
+	for _, l := range lines {
+		ids = append(ids, l.Device.ID)
+	}
+	return ids
+}
+
+func sortedKeys(m map[string][]Line) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// LinesOf превращает позиции заявки во входные данные проверки
+func LinesOf(items []models.OrderItem) []Line {
+	lines := make([]Line, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, Line{Device: item.Device, Quantity: item.Quantity})
+	}
+	return lines
+}
+
+// LoadHubs загружает активные хабы каталога для подсказок
+func LoadHubs(db *gorm.DB) ([]models.SmartDevice, error) {
+	var hubs []models.SmartDevice
+	err := db.Preload("DeviceType").
+		Where("is_active = ? AND device_type_id IN (?)", true,
+			db.Model(&models.DeviceType{}).Select("id").Where("code = ?", HubTypeCode)).
+		Order("id").
+		Find(&hubs).Error
+	return hubs, err
+}
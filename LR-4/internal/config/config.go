@@ -0,0 +1,370 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config - настройки приложения. Порядок применения:
+// значения по умолчанию -> YAML-файл -> переменные окружения.
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	Redis    RedisConfig    `yaml:"redis"`
+	Session  SessionConfig  `yaml:"session"`
+	Storage  StorageConfig  `yaml:"storage"`
+	MinIO    MinIOConfig    `yaml:"minio"`
+	CORS     CORSConfig     `yaml:"cors"`
+}
+
+type ServerConfig struct {
+	Addr            string        `yaml:"addr"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // сколько ждать завершения запросов при остановке
+}
+
+type DatabaseConfig struct {
+	DSN string `yaml:"dsn"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+type SessionConfig struct {
+	Store        string        `yaml:"store"` // redis или memory
+	TTL          time.Duration `yaml:"ttl"`
+	SecureCookie bool          `yaml:"secure_cookie"`
+}
+
+// StorageConfig - где хранятся загруженные картинки
+type StorageConfig struct {
+	Backend string             `yaml:"backend"` // minio | local
+	Local   LocalStorageConfig `yaml:"local"`
+	// Ограничения на загружаемые картинки
+	MaxUploadSize     int64 `yaml:"max_upload_size"`     // байт
+	MaxImageDimension int   `yaml:"max_image_dimension"` // максимальная ширина и высота, px
+}
+
+// LocalStorageConfig - файлы на диске, их раздает само приложение (для разработки и тестов)
+type LocalStorageConfig struct {
+	Dir       string `yaml:"dir"`
+	PublicURL string `yaml:"public_url"` // путь в URL определяет маршрут, например /uploads/
+}
+
+type MinIOConfig struct {
+	Endpoint  string `yaml:"endpoint"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	UseSSL    bool   `yaml:"use_ssl"`
+	Bucket    string `yaml:"bucket"`
+	PublicURL string `yaml:"public_url"` // адрес, по которому картинки доступны браузеру
+}
+
+// CORSConfig - какие фронтенды могут обращаться к API из браузера
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins"` // "*" - любой источник (только без credentials)
+	AllowedMethods   []string      `yaml:"allowed_methods"`
+	AllowedHeaders   []string      `yaml:"allowed_headers"`
+	ExposedHeaders   []string      `yaml:"exposed_headers"` // заголовки ответа, доступные JS
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"` // сколько браузер кэширует preflight
+}
+
+// DefaultPath - файл конфигурации, который читается, если путь не задан явно
+const DefaultPath = "config.yaml"
+
+// Default возвращает настройки для локального запуска с docker-compose
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:            ":8080",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    60 * time.Second,
+			IdleTimeout:     120 * time.Second,
+			ShutdownTimeout: 15 * time.Second,
+		},
+		Database: DatabaseConfig{
+			DSN: "host=localhost user=root password=root dbname=RIP port=5433 sslmode=disable",
+		},
+		Redis: RedisConfig{
+			Addr:     "localhost:6379",
+			Password: "password",
+		},
+		Session: SessionConfig{
+			Store: "redis",
+			TTL:   24 * time.Hour,
+		},
+		Storage: StorageConfig{
+			Backend: "minio",
+			Local: LocalStorageConfig{
+				Dir:       "uploads",
+				PublicURL: "http://localhost:8080/uploads",
+			},
+			MaxUploadSize:     10 << 20, // 10 MB
+			MaxImageDimension: 8000,
+		},
+		MinIO: MinIOConfig{
+			Endpoint:  "minio:9000",
+			AccessKey: "myaccesskey123",
+			SecretKey: "mysecretkey123456",
+			Bucket:    "image",
+			PublicURL: "http://localhost:9000",
+		},
+		CORS: CORSConfig{
+			AllowedOrigins:   []string{"http://localhost:5173", "http://localhost:3000"}, // react-frontend (vite) и локальный фронтенд
+			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders:   []string{"Content-Type"},
+			ExposedHeaders:   []string{"X-Total-Count", "X-Next-Cursor", "Link"}, // пагинация списков
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
+		},
+	}
+}
+
+// Load читает конфигурацию. Путь берется из аргумента, затем из CONFIG_FILE;
+// если ни один не задан, используется config.yaml при его наличии.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	explicit := true
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		path = DefaultPath
+		explicit = false
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("parse %s: %w", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+		// Файл необязателен - работаем на значениях по умолчанию и окружении
+	default:
+		return cfg, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// applyEnv переопределяет значения из переменных окружения
+func (c *Config) applyEnv() error {
+	setString(&c.Server.Addr, "SERVER_ADDR")
+	setString(&c.Database.DSN, "DATABASE_DSN")
+	setString(&c.Redis.Addr, "REDIS_ADDR")
+	setString(&c.Redis.Password, "REDIS_PASSWORD")
+	setString(&c.Session.Store, "SESSION_STORE")
+	setString(&c.Storage.Backend, "STORAGE_BACKEND")
+	setString(&c.Storage.Local.Dir, "STORAGE_LOCAL_DIR")
+	setString(&c.Storage.Local.PublicURL, "STORAGE_LOCAL_PUBLIC_URL")
+	setString(&c.MinIO.Endpoint, "MINIO_ENDPOINT")
+	setString(&c.MinIO.AccessKey, "MINIO_ACCESS_KEY")
+	setString(&c.MinIO.SecretKey, "MINIO_SECRET_KEY")
+	setString(&c.MinIO.Bucket, "MINIO_BUCKET")
+	setString(&c.MinIO.PublicURL, "MINIO_PUBLIC_URL")
+	setList(&c.CORS.AllowedOrigins, "CORS_ALLOWED_ORIGINS")
+	setList(&c.CORS.ExposedHeaders, "CORS_EXPOSED_HEADERS")
+
+	if v, ok := os.LookupEnv("REDIS_DB"); ok {
+		db, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("REDIS_DB: %w", err)
+		}
+		c.Redis.DB = db
+	}
+	if v, ok := os.LookupEnv("STORAGE_MAX_UPLOAD_SIZE"); ok {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("STORAGE_MAX_UPLOAD_SIZE: %w", err)
+		}
+		c.Storage.MaxUploadSize = size
+	}
+	if v, ok := os.LookupEnv("STORAGE_MAX_IMAGE_DIMENSION"); ok {
+		dim, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("STORAGE_MAX_IMAGE_DIMENSION: %w", err)
+		}
+		c.Storage.MaxImageDimension = dim
+	}
+
+	durations := map[string]*time.Duration{
+		"SERVER_READ_TIMEOUT":     &c.Server.ReadTimeout,
+		"SERVER_WRITE_TIMEOUT":    &c.Server.WriteTimeout,
+		"SERVER_IDLE_TIMEOUT":     &c.Server.IdleTimeout,
+		"SERVER_SHUTDOWN_TIMEOUT": &c.Server.ShutdownTimeout,
+		"SESSION_TTL":             &c.Session.TTL,
+		"CORS_MAX_AGE":            &c.CORS.MaxAge,
+	}
+	for env, dst := range durations {
+		if err := setDuration(dst, env); err != nil {
+			return err
+		}
+	}
+
+	if err := setBool(&c.Session.SecureCookie, "SESSION_SECURE_COOKIE"); err != nil {
+		return err
+	}
+	if err := setBool(&c.MinIO.UseSSL, "MINIO_USE_SSL"); err != nil {
+		return err
+	}
+	if err := setBool(&c.CORS.AllowCredentials, "CORS_ALLOW_CREDENTIALS"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Validate проверяет конфигурацию и возвращает все найденные ошибки разом
+func (c Config) Validate() error {
+	var errs []string
+
+	if c.Server.Addr == "" {
+		errs = append(errs, "server.addr is required")
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 {
+		errs = append(errs, "server timeouts must be positive")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, "server.shutdown_timeout must be positive")
+	}
+	if c.Database.DSN == "" {
+		errs = append(errs, "database.dsn is required")
+	}
+
+	switch c.Session.Store {
+	case "redis":
+		if c.Redis.Addr == "" {
+			errs = append(errs, "redis.addr is required for redis session store")
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Sprintf("session.store must be redis or memory, got %q", c.Session.Store))
+	}
+	if c.Session.TTL <= 0 {
+		errs = append(errs, "session.ttl must be positive")
+	}
+
+	switch c.Storage.Backend {
+	case "minio":
+		if c.MinIO.Endpoint == "" {
+			errs = append(errs, "minio.endpoint is required")
+		}
+		if c.MinIO.Bucket == "" {
+			errs = append(errs, "minio.bucket is required")
+		}
+		if c.MinIO.AccessKey == "" || c.MinIO.SecretKey == "" {
+			errs = append(errs, "minio.access_key and minio.secret_key are required")
+		}
+		if u, err := url.Parse(c.MinIO.PublicURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("minio.public_url must be an absolute URL, got %q", c.MinIO.PublicURL))
+		}
+	case "local":
+		if c.Storage.Local.Dir == "" {
+			errs = append(errs, "storage.local.dir is required")
+		}
+		if u, err := url.Parse(c.Storage.Local.PublicURL); err != nil || u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			errs = append(errs, fmt.Sprintf("storage.local.public_url must be an absolute URL with a path, got %q", c.Storage.Local.PublicURL))
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("storage.backend must be minio or local, got %q", c.Storage.Backend))
+	}
+	if c.Storage.MaxUploadSize <= 0 {
+		errs = append(errs, "storage.max_upload_size must be positive")
+	}
+	if c.Storage.MaxImageDimension <= 0 {
+		errs = append(errs, "storage.max_image_dimension must be positive")
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			if c.CORS.AllowCredentials {
+				errs = append(errs, `cors.allowed_origins "*" cannot be used with cors.allow_credentials`)
+			}
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			errs = append(errs, fmt.Sprintf("cors.allowed_origins must be scheme://host[:port], got %q", origin))
+		}
+	}
+	if c.CORS.MaxAge < 0 {
+		errs = append(errs, "cors.max_age must not be negative")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func setString(dst *string, env string) {
+	if v, ok := os.LookupEnv(env); ok {
+		*dst = v
+	}
+}
+
+// setList читает список через запятую: "a, b,c"
+func setList(dst *[]string, env string) {
+	v, ok := os.LookupEnv(env)
+	if !ok {
+		return
+	}
+
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*dst = list
+}
+
+func setDuration(dst *time.Duration, env string) error {
+	v, ok := os.LookupEnv(env)
+	if !ok {
+		return nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", env, err)
+	}
+	*dst = d
+	return nil
+}
+
+func setBool(dst *bool, env string) error {
+	v, ok := os.LookupEnv(env)
+	if !ok {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", env, err)
+	}
+	*dst = b
+	return nil
+}
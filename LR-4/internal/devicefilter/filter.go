@@ -0,0 +1,180 @@
+package devicefilter
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"smartdevices/internal/apperr"
+
+	"gorm.io/gorm"
+)
+
+// Protocols - поддерживаемые протоколы связи устройств
+var Protocols = []string{"Wi-Fi", "Zigbee", "Bluetooth", "Z-Wave", "Thread", "Matter"}
+
+const dateLayout = "2006-01-02"
+
+// Range - числовой диапазон, границы необязательны и включаются
+type Range struct {
+	Min *float64
+	Max *float64
+}
+
+// Filter - условия отбора устройств каталога. Используется и HTML-страницей, и API,
+// поэтому параметры запроса понимаются одинаково.
+type Filter struct {
+	Search          string   // полнотекстовый поиск по названию, модели и описаниям
+	Protocols       []string // любой из протоколов
+	Model           string   // подстрока в модели
+	DataPerHour     Range
+	AvgDataRate     Range
+	CreatedFrom     *time.Time // с начала дня
+	CreatedTo       *time.Time // до конца дня включительно
+	IncludeInactive bool       // только для модераторов
+}
+
+// FromQuery разбирает параметры:
+//
+//	search, model, protocol=Wi-Fi,Zigbee (или несколько protocol=...),
+//	data_per_hour_min/max, avg_data_rate_min/max,
+//	created_from/created_to (YYYY-MM-DD), include_inactive=true
+//
+// include_inactive учитывается, только если allowInactive = true.
+// Возвращает все ошибки в параметрах разом.
+func FromQuery(q url.Values, allowInactive bool) (Filter, error) {
+	var (
+		f    Filter
+		errs []apperr.FieldError
+	)
+
+	f.Search = strings.TrimSpace(q.Get("search"))
+	f.Model = strings.TrimSpace(q.Get("model"))
+
+	for _, value := range q["protocol"] {
+		for _, p := range strings.Split(value, ",") {
+			p = strings.TrimSpace(p)
+			if p == "" || slices.Contains(f.Protocols, p) {
+				continue
+			}
+			if !slices.Contains(Protocols, p) {
+				errs = append(errs, apperr.FieldError{
+					Field:   "protocol",
+					Code:    "oneof",
+					Message: fmt.Sprintf("protocol must be one of: %s", strings.Join(Protocols, ", ")),
+				})
+				break
+			}
+			f.Protocols = append(f.Protocols, p)
+		}
+	}
+
+	f.DataPerHour = parseRange(q, "data_per_hour", &errs)
+	f.AvgDataRate = parseRange(q, "avg_data_rate", &errs)
+
+	f.CreatedFrom = parseDate(q, "created_from", &errs)
+	f.CreatedTo = parseDate(q, "created_to", &errs)
+	if f.CreatedFrom != nil && f.CreatedTo != nil && f.CreatedFrom.After(*f.CreatedTo) {
+		errs = append(errs, apperr.FieldError{Field: "created_from", Code: "range", Message: "created_from must not be after created_to"})
+	}
+
+	if v := q.Get("include_inactive"); v != "" {
+		include, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, apperr.FieldError{Field: "include_inactive", Code: "type", Message: "include_inactive must be true or false"})
+		}
+		f.IncludeInactive = include && allowInactive
+	}
+
+	if len(errs) > 0 {
+		e := apperr.Validation(errs...)
+		e.Detail = "Invalid filter parameters"
+		return f, e
+	}
+	return f, nil
+}
+
+// Apply добавляет условия фильтра к запросу по таблице smart_devices
+func (f Filter) Apply(q *gorm.DB) *gorm.DB {
+	if !f.IncludeInactive {
+		q = q.Where("is_active = ?", true)
+	}
+
+	if f.Search != "" {
+		q = matchSearch(q, f.Search)
+	}
+	if f.Model != "" {
+		q = q.Where("model ILIKE ?", "%"+f.Model+"%")
+	}
+	if len(f.Protocols) > 0 {
+		q = q.Where("protocol IN ?", f.Protocols)
+	}
+
+	q = f.DataPerHour.apply(q, "data_per_hour")
+	q = f.AvgDataRate.apply(q, "avg_data_rate")
+
+	if f.CreatedFrom != nil {
+		q = q.Where("created_at >= ?", *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		q = q.Where("created_at < ?", f.CreatedTo.AddDate(0, 0, 1))
+	}
+
+	return q
+}
+
+func (r Range) apply(q *gorm.DB, column string) *gorm.DB {
+	if r.Min != nil {
+		q = q.Where(column+" >= ?", *r.Min)
+	}
+	if r.Max != nil {
+		q = q.Where(column+" <= ?", *r.Max)
+	}
+	return q
+}
+
+func parseRange(q url.Values, name string, errs *[]apperr.FieldError) Range {
+	var r Range
+	r.Min = parseFloat(q, name+"_min", errs)
+	r.Max = parseFloat(q, name+"_max", errs)
+
+	if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		*errs = append(*errs, apperr.FieldError{
+			Field:   name + "_min",
+			Code:    "range",
+			Message: fmt.Sprintf("%s_min must not exceed %s_max", name, name),
+		})
+	}
+	return r
+}
+
+func parseFloat(q url.Values, name string, errs *[]apperr.FieldError) *float64 {
+	v := q.Get(name)
+	if v == "" {
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		*errs = append(*errs, apperr.FieldError{Field: name, Code: "type", Message: name + " must be a number"})
+		return nil
+	}
+	return &f
+}
+
+func parseDate(q url.Values, name string, errs *[]apperr.FieldError) *time.Time {
+	v := q.Get(name)
+	if v == "" {
+		return nil
+	}
+
+	t, err := time.Parse(dateLayout, v)
+	if err != nil {
+		*errs = append(*errs, apperr.FieldError{Field: name, Code: "type", Message: name + " must be a date in YYYY-MM-DD format"})
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,175 @@
+package devicefilter
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// searchSchema - полнотекстовый индекс каталога. Колонка search_vector вычисляется
+// самим Postgres (русская и английская морфология), поэтому в модели ее нет.
+// Веса: A - название, B - модель, C - краткое описание, D - полное описание.
+var searchSchema = []string{
+	`ALTER TABLE smart_devices ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (
+			setweight(to_tsvector('russian'::regconfig, coalesce(name, '')), 'A') ||
+			setweight(to_tsvector('english'::regconfig, coalesce(name, '')), 'A') ||
+			setweight(to_tsvector('russian'::regconfig, coalesce(model, '')), 'B') ||
+			setweight(to_tsvector('english'::regconfig, coalesce(model, '')), 'B') ||
+			setweight(to_tsvector('russian'::regconfig, coalesce(description, '')), 'C') ||
+			setweight(to_tsvector('english'::regconfig, coalesce(description, '')), 'C') ||
+			setweight(to_tsvector('russian'::regconfig, coalesce(description_all, '')), 'D') ||
+			setweight(to_tsvector('english'::regconfig, coalesce(description_all, '')), 'D')
+		) STORED`,
+	`CREATE INDEX IF NOT EXISTS idx_smart_devices_search ON smart_devices USING GIN (search_vector)`,
+}
+
+// MigrateSearch создает колонку search_vector и GIN-индекс (повторный запуск безопасен)
+func MigrateSearch(db *gorm.DB) error {
+	for _, stmt := range searchSchema {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tsQuery - запрос пользователя в синтаксисе веб-поиска ("умная лампа" -датчик),
+// разобранный в обеих конфигурациях. Текст запроса передается дважды.
+const tsQuery = "(websearch_to_tsquery('russian', ?) || websearch_to_tsquery('english', ?))"
+
+// prefixQuery - то же для автодополнения: последнее слово может быть недописано
+const prefixQuery = "(to_tsquery('russian', ?) || to_tsquery('english', ?))"
+
+func matchSearch(q *gorm.DB, text string) *gorm.DB {
+	return q.Where("search_vector @@ "+tsQuery, text, text)
+}
+
+// OrderByRank сортирует результаты поиска по релевантности (ts_rank)
+func (f Filter) OrderByRank(q *gorm.DB) *gorm.DB {
+	if f.Search == "" {
+		return q
+	}
+	return q.Select("smart_devices.*, ts_rank(search_vector, "+tsQuery+") AS search_rank", f.Search, f.Search).
+		Order("search_rank DESC")
+}
+
+// Highlight - фрагменты с подсвеченными (<mark>) совпадениями. Name и Snippet -
+// готовый HTML: текст экранирован, единственная разметка - <mark>.
+type Highlight struct {
+	ID      uint    `json:"-"`
+	Rank    float64 `json:"rank"`
+	Name    string  `json:"name"`
+	Snippet string  `json:"snippet"`
+}
+
+// Границы совпадений в ts_headline - управляющие символы, а не <mark>: разметку
+// добавляет markHTML уже после экранирования текста из БД
+const (
+	markStart = "\x01"
+	markStop  = "\x02"
+
+	nameHeadline    = "StartSel=" + markStart + ", StopSel=" + markStop + ", HighlightAll=true"
+	snippetHeadline = "StartSel=" + markStart + ", StopSel=" + markStop + ", MaxFragments=2, MaxWords=20, MinWords=5"
+)
+
+// Highlights возвращает подсветку совпадений для найденных устройств (по id)
+func (f Filter) Highlights(db *gorm.DB, ids []uint) (map[uint]Highlight, error) {
+	result := make(map[uint]Highlight, len(ids))
+	if f.Search == "" || len(ids) == 0 {
+		return result, nil
+	}
+
+	var rows []Highlight
+	err := db.Raw(`
+		SELECT id,
+			ts_rank(search_vector, `+tsQuery+`) AS rank,
+			ts_headline('russian', name, `+tsQuery+`, ?) AS name,
+			ts_headline('russian', coalesce(nullif(description_all, ''), description), `+tsQuery+`, ?) AS snippet
+		FROM smart_devices
+		WHERE id IN ?`,
+		f.Search, f.Search,
+		f.Search, f.Search, nameHeadline,
+		f.Search, f.Search, snippetHeadline,
+		ids,
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		row.Name = markHTML(row.Name)
+		row.Snippet = markHTML(row.Snippet)
+		result[row.ID] = row
+	}
+	return result, nil
+}
+
+// markHTML экранирует фрагмент и заменяет границы совпадений на <mark>...</mark>.
+// Такие же символы в самом тексте дают не более чем лишний, но закрытый <mark>.
+func markHTML(s string) string {
+	var b strings.Builder
+	open := false
+	for {
+		i := strings.IndexAny(s, markStart+markStop)
+		if i < 0 {
+			b.WriteString(html.EscapeString(s))
+			break
+		}
+		b.WriteString(html.EscapeString(s[:i]))
+
+		switch {
+		case s[i] == markStart[0] && !open:
+			b.WriteString("<mark>")
+			open = true
+		case s[i] == markStop[0] && open:
+			b.WriteString("</mark>")
+			open = false
+		}
+		s = s[i+1:]
+	}
+	if open {
+		b.WriteString("</mark>")
+	}
+	return b.String()
+}
+
+// Suggestion - вариант автодополнения
+type Suggestion struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Model string `json:"model"`
+}
+
+// Suggest ищет активные устройства по началу слов: "ламп" находит "Лампочка"
+func Suggest(db *gorm.DB, text string, limit int) ([]Suggestion, error) {
+	query := prefixTSQuery(text)
+	if query == "" {
+		return []Suggestion{}, nil
+	}
+
+	suggestions := []Suggestion{}
+	err := db.Raw(`
+		SELECT id, name, model
+		FROM smart_devices
+		WHERE is_active AND search_vector @@ `+prefixQuery+`
+		ORDER BY ts_rank(search_vector, `+prefixQuery+`) DESC, name
+		LIMIT ?`,
+		query, query, query, query, limit,
+	).Scan(&suggestions).Error
+	return suggestions, err
+}
+
+// prefixTSQuery превращает "умн ламп" в "умн:* & ламп:*", отбрасывая операторы tsquery
+func prefixTSQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
@@ -0,0 +1,87 @@
+package devicetype
+
+import (
+	"fmt"
+	"strings"
+
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// CodeOther - тип для устройств, которые не удалось классифицировать
+const CodeOther = "other"
+
+// DefaultCoefficient - коэффициент трафика устройства без типа
+const DefaultCoefficient = 1.0
+
+// preset - стандартный тип и слова, по которым он узнается в названии или модели
+type preset struct {
+	Type     models.DeviceType
+	Keywords []string
+}
+
+// presets проверяются по порядку: первое совпадение определяет тип.
+// Коэффициенты совпадают с прежней формулой расчета по названию.
+var presets = []preset{
+	{models.DeviceType{Code: "hub", Name: "Хаб", TrafficCoefficient: 1.3}, []string{"хаб", "hub", "шлюз", "gateway"}},
+	{models.DeviceType{Code: "camera", Name: "Камера", TrafficCoefficient: 1.5}, []string{"камер", "camera"}},
+	{models.DeviceType{Code: "sensor", Name: "Датчик", TrafficCoefficient: 0.7}, []string{"датчик", "sensor"}},
+	{models.DeviceType{Code: "bulb", Name: "Лампа", TrafficCoefficient: 1.1}, []string{"ламп", "bulb", "lamp"}},
+	{models.DeviceType{Code: "socket", Name: "Розетка", TrafficCoefficient: 0.9}, []string{"розетк", "socket", "plug"}},
+	{models.DeviceType{Code: "switch", Name: "Выключатель", TrafficCoefficient: 0.8}, []string{"выключател", "switch"}},
+	{models.DeviceType{Code: CodeOther, Name: "Другое", TrafficCoefficient: DefaultCoefficient}, nil},
+}
+
+// Migrate создает стандартные типы (существующие не перезаписываются, чтобы не
+// потерять коэффициенты, измененные модератором) и проставляет тип устройствам,
+// у которых его еще нет: по названию и модели, иначе - "other".
+func Migrate(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, p := range presets {
+			err := tx.Exec(`
+				INSERT INTO device_types (code, name, traffic_coefficient, created_at)
+				VALUES (?, ?, ?, NOW())
+				ON CONFLICT (code) DO NOTHING`,
+				p.Type.Code, p.Type.Name, p.Type.TrafficCoefficient,
+			).Error
+			if err != nil {
+				return fmt.Errorf("device type %s: %w", p.Type.Code, err)
+			}
+		}
+
+		for _, p := range presets {
+			query := tx.Model(&models.SmartDevice{}).Where("device_type_id IS NULL")
+			if len(p.Keywords) > 0 {
+				query = query.Where(keywordCondition(tx, p.Keywords))
+			}
+
+			result := query.Update("device_type_id", tx.Model(&models.DeviceType{}).Select("id").Where("code = ?", p.Type.Code))
+			if result.Error != nil {
+				return fmt.Errorf("classify %s: %w", p.Type.Code, result.Error)
+			}
+			if result.RowsAffected > 0 {
+				fmt.Printf("✓ Тип %s: %d устройств\n", p.Type.Code, result.RowsAffected)
+			}
+		}
+		return nil
+	})
+}
+
+// keywordCondition - название или модель содержит любое из слов
+func keywordCondition(db *gorm.DB, keywords []string) *gorm.DB {
+	cond := db.Session(&gorm.Session{NewDB: true})
+	for _, k := range keywords {
+		pattern := "%" + strings.ToLower(k) + "%"
+		cond = cond.Or("LOWER(name) LIKE ? OR LOWER(model) LIKE ?", pattern, pattern)
+	}
+	return cond
+}
+
+// Coefficient - коэффициент трафика устройства (тип должен быть загружен через Preload)
+func Coefficient(device models.SmartDevice) float64 {
+	if device.DeviceType == nil {
+		return DefaultCoefficient
+	}
+	return device.DeviceType.TrafficCoefficient
+}
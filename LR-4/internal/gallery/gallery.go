@@ -0,0 +1,312 @@
+package gallery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"smartdevices/internal/images"
+	"smartdevices/internal/models"
+	"smartdevices/internal/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxImages - сколько картинок может быть у одного устройства
+const MaxImages = 20
+
+var (
+	// ErrTooMany - в галерее уже MaxImages картинок
+	ErrTooMany = errors.New("too many images")
+	// ErrOrder - новый порядок не совпадает с набором картинок устройства
+	ErrOrder = errors.New("image order must list every device image exactly once")
+)
+
+// List возвращает картинки устройства по порядку
+func List(db *gorm.DB, deviceID uint) ([]models.DeviceImage, error) {
+	var list []models.DeviceImage
+	err := db.Where("device_id = ?", deviceID).Order("position, id").Find(&list).Error
+	return list, err
+}
+
+// Find загружает картинку устройства; gorm.ErrRecordNotFound, если ее нет
+// или она принадлежит другому устройству
+func Find(db *gorm.DB, deviceID, imageID uint) (models.DeviceImage, error) {
+	var img models.DeviceImage
+	err := db.Where("device_id = ?", deviceID).First(&img, imageID).Error
+	return img, err
+}
+
+// Add добавляет в конец галереи объект key, уже сохраненный в хранилище.
+// Первая картинка устройства становится главной. Если добавить не удалось,
+// объект удаляется, чтобы не остаться в хранилище без записи.
+func Add(ctx context.Context, db *gorm.DB, store storage.ObjectStore, deviceID uint, key, altText string, primary bool) (models.DeviceImage, error) {
+	return add(ctx, db, store, deviceID, key, altText, primary, false)
+}
+
+// add - Add для обычного добавления и для замены главной картинки (replace):
+// при замене прежняя главная картинка будет удалена, поэтому в лимит MaxImages
+// она не засчитывается
+func add(ctx context.Context, db *gorm.DB, store storage.ObjectStore, deviceID uint, key, altText string, primary, replace bool) (models.DeviceImage, error) {
+	img := models.DeviceImage{
+		DeviceID: deviceID,
+		Key:      key,
+		URL:      store.URL(key),
+		AltText:  altText,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockDevice(tx, deviceID); err != nil {
+			return err
+		}
+
+		var count, replaced int64
+		if err := tx.Model(&models.DeviceImage{}).Where("device_id = ?", deviceID).Count(&count).Error; err != nil {
+			return err
+		}
+		if replace {
+			if err := tx.Model(&models.DeviceImage{}).Where("device_id = ? AND is_primary", deviceID).Count(&replaced).Error; err != nil {
+				return err
+			}
+		}
+		if count-replaced >= MaxImages {
+			return ErrTooMany
+		}
+
+		img.Position = int(count)
+		img.IsPrimary = primary || count == 0
+		if img.IsPrimary {
+			if err := unsetPrimary(tx, deviceID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Omit("Device").Create(&img).Error; err != nil {
+			return err
+		}
+		return syncDevice(tx, deviceID)
+	})
+	if err != nil {
+		deleteObject(ctx, store, key)
+		return models.DeviceImage{}, err
+	}
+
+	// Копии для srcset. Ошибка не отменяет загрузку: их создаст cmd/image-variants.
+	if _, err := images.Generate(ctx, db, store, key); err != nil {
+		log.Printf("⚠️ Failed to generate image variants for %s: %v", key, err)
+	}
+	return img, nil
+}
+
+// Replace делает объект key главной картинкой вместо прежней. Прежняя главная
+// картинка удаляется из галереи и хранилища, как и картинка, заданная до появления
+// галереи только в NamespaceURL.
+func Replace(ctx context.Context, db *gorm.DB, store storage.ObjectStore, device models.SmartDevice, key, altText string) (models.DeviceImage, error) {
+	var previous []models.DeviceImage
+	if err := db.Where("device_id = ? AND is_primary", device.ID).Find(&previous).Error; err != nil {
+		deleteObject(ctx, store, key)
+		return models.DeviceImage{}, err
+	}
+
+	img, err := add(ctx, db, store, device.ID, key, altText, true, true)
+	if err != nil {
+		return models.DeviceImage{}, err
+	}
+
+	for _, p := range previous {
+		if err := Delete(ctx, db, store, p); err != nil {
+			log.Printf("⚠️ Failed to delete replaced image %s: %v", p.Key, err)
+		}
+	}
+	if len(previous) == 0 {
+		if oldKey, ok := store.Key(device.NamespaceURL); ok && oldKey != key {
+			deleteUnreferenced(ctx, db, store, oldKey)
+		}
+	}
+
+	// Новая главная картинка - первая в галерее
+	list, err := List(db, device.ID)
+	if err != nil {
+		return img, err
+	}
+	ids := []uint{img.ID}
+	for _, other := range list {
+		if other.ID != img.ID {
+			ids = append(ids, other.ID)
+		}
+	}
+	if err := Reorder(db, device.ID, ids); err != nil {
+		return img, err
+	}
+	img.Position = 0
+	return img, nil
+}
+
+// Delete удаляет картинку из галереи, ее объект и копии из хранилища.
+// Если удалена главная, главной становится первая из оставшихся.
+func Delete(ctx context.Context, db *gorm.DB, store storage.ObjectStore, img models.DeviceImage) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockDevice(tx, img.DeviceID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.DeviceImage{}, img.ID).Error; err != nil {
+			return err
+		}
+
+		rest, err := List(tx, img.DeviceID)
+		if err != nil {
+			return err
+		}
+		for i, other := range rest {
+			if other.Position != i {
+				if err := tx.Model(&models.DeviceImage{}).Where("id = ?", other.ID).Update("position", i).Error; err != nil {
+					return err
+				}
+			}
+		}
+		hasPrimary := slices.ContainsFunc(rest, func(other models.DeviceImage) bool { return other.IsPrimary })
+		if !hasPrimary && len(rest) > 0 {
+			if err := tx.Model(&models.DeviceImage{}).Where("id = ?", rest[0].ID).Update("is_primary", true).Error; err != nil {
+				return err
+			}
+		}
+		return syncDevice(tx, img.DeviceID)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Запись уже удалена: объект, который не удалось удалить, лишь занимает место
+	if err := images.DeleteVariants(ctx, db, store, img.Key); err != nil {
+		log.Printf("⚠️ Failed to delete image variants for %s: %v", img.Key, err)
+	}
+	deleteObject(ctx, store, img.Key)
+	return nil
+}
+
+// Reorder задает порядок галереи: ids - все картинки устройства в новом порядке
+func Reorder(db *gorm.DB, deviceID uint, ids []uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := lockDevice(tx, deviceID); err != nil {
+			return err
+		}
+
+		list, err := List(tx, deviceID)
+		if err != nil {
+			return err
+		}
+		current := make([]uint, len(list))
+		for i, img := range list {
+			current[i] = img.ID
+		}
+		requested := slices.Clone(ids)
+		slices.Sort(current)
+		slices.Sort(requested)
+		if !slices.Equal(current, requested) {
+			return ErrOrder
+		}
+
+		for position, id := range ids {
+			if err := tx.Model(&models.DeviceImage{}).Where("id = ?", id).Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetPrimary делает картинку главной для устройства
+func SetPrimary(db *gorm.DB, img models.DeviceImage) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := lockDevice(tx, img.DeviceID); err != nil {
+			return err
+		}
+		if err := unsetPrimary(tx, img.DeviceID); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.DeviceImage{}).Where("id = ?", img.ID).Update("is_primary", true).Error; err != nil {
+			return err
+		}
+		return syncDevice(tx, img.DeviceID)
+	})
+}
+
+// UpdateAltText меняет подпись картинки
+func UpdateAltText(db *gorm.DB, img *models.DeviceImage, altText string) error {
+	img.AltText = altText
+	return db.Model(img).Update("alt_text", altText).Error
+}
+
+// Migrate создает галерею из одной главной картинки для устройств, у которых
+// картинка из хранилища задана только в NamespaceURL
+func Migrate(db *gorm.DB, store storage.ObjectStore) error {
+	var devices []models.SmartDevice
+	err := db.Where("namespace_url <> '' AND NOT EXISTS (?)",
+		db.Model(&models.DeviceImage{}).Select("1").Where("device_images.device_id = smart_devices.id")).
+		Find(&devices).Error
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		key, ok := store.Key(device.NamespaceURL)
+		if !ok {
+			continue
+		}
+		img := models.DeviceImage{
+			DeviceID:  device.ID,
+			Key:       key,
+			URL:       device.NamespaceURL,
+			AltText:   device.Name,
+			IsPrimary: true,
+		}
+		if err := db.Omit("Device").Create(&img).Error; err != nil {
+			return fmt.Errorf("device %d: %w", device.ID, err)
+		}
+	}
+	return nil
+}
+
+// lockDevice блокирует строку устройства до конца транзакции, чтобы изменения
+// одной галереи (порядок, главная картинка) не выполнялись параллельно
+func lockDevice(tx *gorm.DB, deviceID uint) error {
+	var device models.SmartDevice
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&device, deviceID).Error
+}
+
+func unsetPrimary(tx *gorm.DB, deviceID uint) error {
+	return tx.Model(&models.DeviceImage{}).
+		Where("device_id = ? AND is_primary", deviceID).
+		Update("is_primary", false).Error
+}
+
+// syncDevice копирует URL главной картинки в SmartDevice.NamespaceURL:
+// списки, корзина и заявки показывают именно его
+func syncDevice(tx *gorm.DB, deviceID uint) error {
+	var primary models.DeviceImage
+	err := tx.Where("device_id = ? AND is_primary", deviceID).Limit(1).Find(&primary).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.SmartDevice{}).Where("id = ?", deviceID).Update("namespace_url", primary.URL).Error
+}
+
+// deleteUnreferenced удаляет объект, если на него не ссылается ни одна картинка галереи
+func deleteUnreferenced(ctx context.Context, db *gorm.DB, store storage.ObjectStore, key string) {
+	var count int64
+	if err := db.Model(&models.DeviceImage{}).Where("key = ?", key).Count(&count).Error; err != nil || count > 0 {
+		return
+	}
+	if err := images.DeleteVariants(ctx, db, store, key); err != nil {
+		log.Printf("⚠️ Failed to delete image variants for %s: %v", key, err)
+	}
+	deleteObject(ctx, store, key)
+}
+
+func deleteObject(ctx context.Context, store storage.ObjectStore, key string) {
+	if err := store.Delete(ctx, key); err != nil {
+		log.Printf("⚠️ Failed to delete image %s: %v", key, err)
+	}
+}
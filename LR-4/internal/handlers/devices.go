@@ -1,26 +1,41 @@
 package handlers
 
 import (
+	"errors"
 	"html/template"
 	"log"
 	"net/http"
 	"strconv"
 
+	"smartdevices/internal/compat"
+	"smartdevices/internal/devicefilter"
+	"smartdevices/internal/gallery"
+	"smartdevices/internal/images"
 	"smartdevices/internal/models"
+	"smartdevices/internal/orderstate"
+	"smartdevices/internal/router"
+	"smartdevices/internal/storage"
+	"smartdevices/internal/traffic"
 
 	"gorm.io/gorm"
 )
 
 var (
 	db                    *gorm.DB
+	trafficCalc           traffic.Calculator
+	compatRules           *compat.Engine
+	store                 storage.ObjectStore
 	tmplSmartDevices      = template.Must(template.ParseFiles("templates/layout.html", "templates/smart_devices.html"))
 	tmplSmartDeviceDetail = template.Must(template.ParseFiles("templates/layout.html", "templates/smart_device_detail.html"))
 	tmplSmartCart         = template.Must(template.ParseFiles("templates/layout.html", "templates/smart_cart.html"))
 	tmpl404               = template.Must(template.ParseFiles("templates/404.html"))
 )
 
-func Init(database *gorm.DB) {
+func Init(database *gorm.DB, calculator traffic.Calculator, compatibility *compat.Engine, objectStore storage.ObjectStore) {
 	db = database
+	trafficCalc = calculator
+	compatRules = compatibility
+	store = objectStore
 }
 
 // Вспомогательная функция для получения количества товаров
@@ -33,18 +48,17 @@ func getSmartCartCount(clientID uint) int64 {
 	return count
 }
 
-// Вспомогательная функция для расчета общего трафика
-func calculateTotalTraffic(orderID uint) float64 {
-	var total float64
+// Вспомогательная функция для расчета общего трафика (тот же расчет, что и в API)
+func calculateTraffic(order models.SmartOrder, items []models.OrderItem) (traffic.Breakdown, map[uint]traffic.Line) {
+	breakdown := traffic.ForOrder(trafficCalc, order, items)
 
-	db.Model(&models.OrderItem{}).
-		Select("SUM(smart_devices.data_per_hour * order_items.quantity)").
-		Joins("JOIN smart_devices ON smart_devices.id = order_items.device_id").
-		Where("order_items.order_id = ?", orderID).
-		Scan(&total)
+	lines := make(map[uint]traffic.Line, len(breakdown.Items))
+	for _, line := range breakdown.Items {
+		lines[line.DeviceID] = line
+	}
 
-	log.Printf("🔄 Расчет трафика для заявки %d: %.2f Кб/ч", orderID, total)
-	return total
+	log.Printf("🔄 Расчет трафика для заявки %d: %.2f Кб/ч", order.ID, breakdown.Total)
+	return breakdown, lines
 }
 
 // Вспомогательная функция для показа 404 страницы
@@ -57,8 +71,7 @@ func Show404Page(w http.ResponseWriter, message string) {
 
 // GET /request/{id} - просмотр заявки по ID
 func RequestByIDHandler(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Path[len("/request/"):]
-	id, err := strconv.Atoi(idStr)
+	id, err := router.UintParam(r, "id")
 	if err != nil {
 		Show404Page(w, "Неверный ID заявки")
 		return
@@ -78,13 +91,20 @@ func RequestByIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db.Preload("Device").Where("order_id = ?", order.ID).Find(&items)
+	items, err = traffic.LoadItems(db, order.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	order.TotalTraffic = calculateTotalTraffic(order.ID)
+	breakdown, lines := calculateTraffic(order, items)
+	order.TotalTraffic = breakdown.Total
 
 	err = tmplSmartCart.ExecuteTemplate(w, "layout.html", map[string]interface{}{
 		"Request":   order,
 		"Items":     items,
+		"Lines":     lines,
+		"Estimate":  traffic.EstimateOf(breakdown),
 		"ShowCart":  false,
 		"CartCount": getSmartCartCount(1),
 	})
@@ -95,26 +115,36 @@ func RequestByIDHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// GET /smart-devices - поиск устройств через GORM
+// GET /smart-devices - поиск устройств через GORM (те же фильтры, что и в API)
 func SmartDevicesHandler(w http.ResponseWriter, r *http.Request) {
-	search := r.URL.Query().Get("search")
-
-	var devices []models.SmartDevice
-	query := db.Where("is_active = ?", true)
-
-	if search != "" {
-		query = query.Where("name ILIKE ?", "%"+search+"%")
+	filter, err := devicefilter.FromQuery(r.URL.Query(), false)
+	if err != nil {
+		http.Error(w, "Некорректные параметры фильтра", http.StatusBadRequest)
+		return
 	}
 
-	result := query.Find(&devices)
+	var devices []models.SmartDevice
+	result := filter.OrderByRank(filter.Apply(db)).Order("id").Find(&devices)
 	if result.Error != nil {
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	err := tmplSmartDevices.ExecuteTemplate(w, "layout.html", map[string]interface{}{
+	// Размеры картинок для srcset: в карточке не нужен оригинал в полном размере
+	urls := make([]string, 0, len(devices))
+	for _, device := range devices {
+		urls = append(urls, device.NamespaceURL)
+	}
+	imageSets, err := images.LoadSets(db, store, urls)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = tmplSmartDevices.ExecuteTemplate(w, "layout.html", map[string]interface{}{
 		"Devices":   devices,
-		"Search":    search,
+		"Images":    imageSets,
+		"Search":    filter.Search,
 		"ShowCart":  true,
 		"CartCount": getSmartCartCount(1),
 	})
@@ -126,8 +156,7 @@ func SmartDevicesHandler(w http.ResponseWriter, r *http.Request) {
 
 // GET /smart-devices/{id} - детальная страница устройства
 func SmartDeviceDetailHandler(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Path[len("/smart-devices/"):]
-	id, err := strconv.Atoi(idStr)
+	id, err := router.UintParam(r, "id")
 	if err != nil {
 		http.Error(w, "Invalid device ID", http.StatusBadRequest)
 		return
@@ -142,10 +171,34 @@ func SmartDeviceDetailHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("📱 Device Detail - ID: %d, Name: %s, NamespaceURL: %s", device.ID, device.Name, device.NamespaceURL)
 
+	// Галерея: главная картинка - NamespaceURL, остальные - миниатюрами под ней
+	list, err := gallery.List(db, device.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	urls := []string{device.NamespaceURL}
+	mainAlt := device.Name
+	for _, img := range list {
+		urls = append(urls, img.URL)
+		if img.IsPrimary && img.AltText != "" {
+			mainAlt = img.AltText
+		}
+	}
+	imageSets, err := images.LoadSets(db, store, urls)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	err = tmplSmartDeviceDetail.ExecuteTemplate(w, "layout.html", map[string]interface{}{
-		"Device":    device,
-		"ShowCart":  false,
-		"CartCount": getSmartCartCount(1),
+		"Device":      device,
+		"Images":      imageSets[device.NamespaceURL],
+		"MainAlt":     mainAlt,
+		"Gallery":     list,
+		"GallerySets": imageSets,
+		"ShowCart":    false,
+		"CartCount":   getSmartCartCount(1),
 	})
 
 	if err != nil {
@@ -166,16 +219,32 @@ func SmartCartHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db.Preload("Device").Where("order_id = ?", order.ID).Find(&items)
+	items, err := traffic.LoadItems(db, order.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	order.TotalTraffic = calculateTotalTraffic(order.ID)
+	breakdown, lines := calculateTraffic(order, items)
+	order.TotalTraffic = breakdown.Total
 
 	log.Printf("📱 Загрузка корзины ID %d: %d товаров, трафик: %.2f Кб/ч",
 		order.ID, len(items), order.TotalTraffic)
 
-	err := tmplSmartCart.ExecuteTemplate(w, "layout.html", map[string]interface{}{
+	// Предварительная проверка совместимости (при формировании она блокирующая)
+	hubs, err := compat.LoadHubs(db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report := compatRules.Check(compat.LinesOf(items), hubs)
+
+	err = tmplSmartCart.ExecuteTemplate(w, "layout.html", map[string]interface{}{
 		"Request":   order,
 		"Items":     items,
+		"Lines":     lines,
+		"Estimate":  traffic.EstimateOf(breakdown),
+		"Compat":    report,
 		"ShowCart":  false,
 		"CartCount": getSmartCartCount(1),
 	})
@@ -188,11 +257,6 @@ func SmartCartHandler(w http.ResponseWriter, r *http.Request) {
 
 // POST /smart-cart/add - добавление в корзину
 func AddToSmartCartHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	deviceID := r.FormValue("device_id")
 	if deviceID == "" {
 		http.Error(w, "Device ID is required", http.StatusBadRequest)
@@ -235,41 +299,51 @@ func AddToSmartCartHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("🆕 Добавлено устройство %d в корзину %d", dID, order.ID)
 	}
 
-	totalTraffic := calculateTotalTraffic(order.ID)
-	log.Printf("📊 Общий трафик корзины %d: %.2f Кб/ч", order.ID, totalTraffic)
-
 	http.Redirect(w, r, "/smart-cart", http.StatusSeeOther)
 }
 
-// POST /smart-cart/delete - удаление корзины через RAW SQL
+// POST /smart-cart/delete - удаление корзины (мягкое, статус deleted)
 func DeleteSmartCartHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	orderID, err := strconv.ParseUint(r.FormValue("order_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Order ID is required", http.StatusBadRequest)
 		return
 	}
 
-	orderID := r.FormValue("order_id")
-	if orderID == "" {
-		http.Error(w, "Order ID is required", http.StatusBadRequest)
+	var order models.SmartOrder
+	if err := db.First(&order, orderID).Error; err != nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
 		return
 	}
 
-	sqlDB, err := db.DB()
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	// Те же правила переходов и та же история, что и в API (клиент страниц - ID 1)
+	actor := orderstate.Actor{ClientID: 1}
+	oldStatus := order.Status
+	if err := orderstate.Apply(&order, orderstate.ActionDelete, actor); err != nil {
+		http.Error(w, "Error deleting order: "+err.Error(), orderStateStatus(err))
 		return
 	}
-
-	_, err = sqlDB.Exec("UPDATE smart_orders SET status = 'deleted' WHERE id = $1", orderID)
-	if err != nil {
-		http.Error(w, "Error deleting order: "+err.Error(), http.StatusInternalServerError)
+	event := orderstate.StatusEvent(order, oldStatus, actor.ClientID)
+	if err := orderstate.SaveWithEvents(db, &order, oldStatus, event); err != nil {
+		http.Error(w, "Error deleting order: "+err.Error(), orderStateStatus(err))
 		return
 	}
 
-	log.Printf("🗑️ Deleted cart: id=%s", orderID)
+	log.Printf("🗑️ Deleted cart: id=%d", orderID)
 	http.Redirect(w, r, "/smart-devices", http.StatusSeeOther)
 }
 
+// orderStateStatus - HTTP-статус для ошибки перехода статуса заявки
+func orderStateStatus(err error) int {
+	switch {
+	case errors.Is(err, orderstate.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, orderstate.ErrInvalidTransition), errors.Is(err, orderstate.ErrConflict):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
 // GET /smart-cart/count - количество товаров в корзине
 func GetSmartCartCountHandler(w http.ResponseWriter, r *http.Request) {
 	var count int64
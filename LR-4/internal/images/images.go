@@ -0,0 +1,182 @@
+package images
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	// ErrUnsupported - содержимое не является картинкой поддерживаемого формата
+	ErrUnsupported = errors.New("unsupported image format")
+	// ErrTooLarge - файл больше Limits.MaxBytes
+	ErrTooLarge = errors.New("image is too large")
+	// ErrDimensions - ширина или высота картинки вне допустимых пределов
+	ErrDimensions = errors.New("invalid image dimensions")
+)
+
+// Format - поддерживаемый формат картинки
+type Format struct {
+	Name        string // имя формата в image.DecodeConfig
+	ContentType string
+	Ext         string
+}
+
+var (
+	PNG  = Format{Name: "png", ContentType: "image/png", Ext: ".png"}
+	JPEG = Format{Name: "jpeg", ContentType: "image/jpeg", Ext: ".jpg"}
+	WebP = Format{Name: "webp", ContentType: "image/webp", Ext: ".webp"}
+	SVG  = Format{Name: "svg", ContentType: "image/svg+xml", Ext: ".svg"}
+)
+
+// Limits - ограничения на загружаемую картинку
+type Limits struct {
+	MaxBytes     int64
+	MaxDimension int // максимальная ширина и высота растровой картинки, px
+}
+
+// sniffLen - сколько байт начала файла смотрим для определения формата
+const sniffLen = 1024
+
+// Sniff определяет формат по содержимому, расширение и заявленный клиентом тип не учитываются
+func Sniff(head []byte) (Format, bool) {
+	switch http.DetectContentType(head) {
+	case PNG.ContentType:
+		return PNG, true
+	case JPEG.ContentType:
+		return JPEG, true
+	case WebP.ContentType:
+		return WebP, true
+	}
+	if looksLikeSVG(head) {
+		return SVG, true
+	}
+	return Format{}, false
+}
+
+// Image - проверенная картинка. Read отдает содержимое для сохранения:
+// растровые файлы читаются из исходного потока по мере записи, SVG - уже очищенный.
+type Image struct {
+	Format Format
+	Width  int
+	Height int
+	// Size - размер содержимого или -1, если он станет известен только после чтения
+	Size int64
+
+	body    io.Reader
+	limited *limitedReader
+}
+
+func (img *Image) Read(p []byte) (int, error) {
+	return img.body.Read(p)
+}
+
+// Err возвращает ErrTooLarge, если при чтении был превышен Limits.MaxBytes.
+// Хранилище может обернуть ошибку чтения так, что errors.Is ее не найдет.
+func (img *Image) Err() error {
+	if img.limited.exceeded {
+		return img.limited.err()
+	}
+	return nil
+}
+
+// BytesRead - сколько байт исходного файла прочитано
+func (img *Image) BytesRead() int64 {
+	return img.limited.read
+}
+
+// Open определяет формат по содержимому и проверяет размеры картинки. В память
+// читается только заголовок растрового файла (SVG - целиком, его нужно очистить),
+// остальное отдается Read по мере сохранения.
+func Open(r io.Reader, limits Limits) (*Image, error) {
+	lr := &limitedReader{r: r, max: limits.MaxBytes}
+	br := bufio.NewReaderSize(lr, sniffLen)
+
+	head, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, err
+	}
+	if len(head) == 0 {
+		return nil, fmt.Errorf("%w: empty file", ErrUnsupported)
+	}
+
+	format, ok := Sniff(head)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, http.DetectContentType(head))
+	}
+
+	img := &Image{Format: format, Size: -1, limited: lr}
+	if format == SVG {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		clean, width, height, err := SanitizeSVG(data)
+		if err != nil {
+			return nil, err
+		}
+		img.Width, img.Height = width, height
+		img.Size = int64(len(clean))
+		img.body = bytes.NewReader(clean)
+		return img, nil
+	}
+
+	// DecodeConfig читает только заголовок; прочитанное запоминаем, чтобы сохранить файл целиком
+	var header bytes.Buffer
+	cfg, name, err := image.DecodeConfig(io.TeeReader(br, &header))
+	if err != nil {
+		if lr.exceeded {
+			return nil, lr.err()
+		}
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if name != format.Name {
+		return nil, fmt.Errorf("%w: content is %s, header is %s", ErrUnsupported, format.Name, name)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 ||
+		(limits.MaxDimension > 0 && (cfg.Width > limits.MaxDimension || cfg.Height > limits.MaxDimension)) {
+		return nil, fmt.Errorf("%w: %dx%d, max %d", ErrDimensions, cfg.Width, cfg.Height, limits.MaxDimension)
+	}
+
+	img.Width, img.Height = cfg.Width, cfg.Height
+	img.body = io.MultiReader(&header, br)
+	return img, nil
+}
+
+// limitedReader возвращает ErrTooLarge, когда прочитано больше max байт (max <= 0 - без ограничения)
+type limitedReader struct {
+	r        io.Reader
+	max      int64
+	read     int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, l.err()
+	}
+	if l.max > 0 && int64(len(p)) > l.max-l.read+1 {
+		p = p[:l.max-l.read+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.max > 0 && l.read > l.max {
+		l.exceeded = true
+		return n, l.err()
+	}
+	return n, err
+}
+
+func (l *limitedReader) err() error {
+	return fmt.Errorf("%w: limit is %d bytes", ErrTooLarge, l.max)
+}
@@ -0,0 +1,176 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"smartdevices/internal/models"
+	"smartdevices/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// Source - один размер картинки
+type Source struct {
+	Width int
+	URL   string
+}
+
+// Set - размеры картинки по возрастанию ширины, включая оригинал
+type Set []Source
+
+// Srcset - значение атрибута srcset: "url 160w, url 480w, ..."
+func (s Set) Srcset() string {
+	parts := make([]string, len(s))
+	for i, src := range s {
+		parts[i] = src.URL + " " + strconv.Itoa(src.Width) + "w"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Map - URL по ширине ("160w"), nil для пустого набора
+func (s Set) Map() map[string]string {
+	if len(s) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(s))
+	for _, src := range s {
+		m[strconv.Itoa(src.Width)+"w"] = src.URL
+	}
+	return m
+}
+
+// Generate создает уменьшенные копии картинки key, сохраняет их рядом с оригиналом
+// и записывает размеры в image_variants, заменяя прежний набор. SVG масштабируется
+// без потерь, для него копии не создаются (возвращается nil).
+func Generate(ctx context.Context, db *gorm.DB, store storage.ObjectStore, key string) ([]models.ImageVariant, error) {
+	if path.Ext(key) == SVG.Ext {
+		return nil, nil
+	}
+
+	rc, _, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	src, name, err := image.Decode(rc)
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrUnsupported, key, err)
+	}
+
+	variants, err := Variants(src, VariantWidths)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []models.ImageVariant{{
+		SourceKey:   key,
+		Key:         key,
+		Width:       src.Bounds().Dx(),
+		Height:      src.Bounds().Dy(),
+		ContentType: "image/" + name,
+	}}
+	for _, v := range variants {
+		variantKey := VariantKey(key, v)
+		if err := store.Put(ctx, variantKey, bytes.NewReader(v.Data), int64(len(v.Data)), v.Format.ContentType); err != nil {
+			return nil, err
+		}
+		rows = append(rows, models.ImageVariant{
+			SourceKey:   key,
+			Key:         variantKey,
+			Width:       v.Width,
+			Height:      v.Height,
+			ContentType: v.Format.ContentType,
+		})
+	}
+
+	slices.SortFunc(rows, func(a, b models.ImageVariant) int { return a.Width - b.Width })
+
+	var old []models.ImageVariant
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("source_key = ?", key).Find(&old).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("source_key = ?", key).Delete(&models.ImageVariant{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Копии прежнего набора, которых нет в новом (другой формат или ширина), больше не нужны
+	current := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		current[row.Key] = true
+	}
+	for _, row := range old {
+		if !current[row.Key] {
+			deleteObject(ctx, store, row.Key)
+		}
+	}
+
+	return rows, nil
+}
+
+// DeleteVariants удаляет из хранилища уменьшенные копии картинки key и записи о них.
+// Сам оригинал удаляет вызывающий код.
+func DeleteVariants(ctx context.Context, db *gorm.DB, store storage.ObjectStore, key string) error {
+	var rows []models.ImageVariant
+	if err := db.Where("source_key = ?", key).Find(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if row.Key != key {
+			deleteObject(ctx, store, row.Key)
+		}
+	}
+	return db.Where("source_key = ?", key).Delete(&models.ImageVariant{}).Error
+}
+
+// deleteObject - ошибка удаления копии не должна мешать основной операции,
+// оставшийся объект лишь занимает место
+func deleteObject(ctx context.Context, store storage.ObjectStore, key string) {
+	if err := store.Delete(ctx, key); err != nil {
+		log.Printf("⚠️ Failed to delete image variant %s: %v", key, err)
+	}
+}
+
+// LoadSets загружает размеры картинок по их URL. Картинки не из хранилища
+// и картинки без записей в image_variants в результат не попадают.
+func LoadSets(db *gorm.DB, store storage.ObjectStore, urls []string) (map[string]Set, error) {
+	urlByKey := make(map[string]string, len(urls))
+	for _, u := range urls {
+		if key, ok := store.Key(u); ok {
+			urlByKey[key] = u
+		}
+	}
+	if len(urlByKey) == 0 {
+		return map[string]Set{}, nil
+	}
+
+	keys := make([]string, 0, len(urlByKey))
+	for key := range urlByKey {
+		keys = append(keys, key)
+	}
+
+	var rows []models.ImageVariant
+	if err := db.Where("source_key IN ?", keys).Order("width").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	sets := make(map[string]Set, len(urlByKey))
+	for _, row := range rows {
+		u := urlByKey[row.SourceKey]
+		sets[u] = append(sets[u], Source{Width: row.Width, URL: store.URL(row.Key)})
+	}
+	return sets, nil
+}
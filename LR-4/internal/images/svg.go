@@ -0,0 +1,307 @@
+package images
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// looksLikeSVG - XML-документ, в начале которого встречается <svg
+func looksLikeSVG(head []byte) bool {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	head = bytes.TrimSpace(head)
+	return bytes.HasPrefix(head, []byte("<")) && bytes.Contains(head, []byte("<svg"))
+}
+
+// svgNamespace - пространство имен SVG; другие объявления xmlns удаляются
+const svgNamespace = "http://www.w3.org/2000/svg"
+
+// xlinkNamespace - для xlink:href в старых файлах
+const xlinkNamespace = "http://www.w3.org/1999/xlink"
+
+// Разрешенные элементы (имена в нижнем регистре). Остальные удаляются вместе с потомками:
+// скрипты, foreignObject, ссылки (a), внешние картинки (image, feImage) и анимации
+// (animate, set), которые могут подменить значение любого атрибута.
+var svgAllowedElements = allowSet(
+	"svg", "g", "defs", "symbol", "use", "title", "desc", "style",
+	"path", "rect", "circle", "ellipse", "line", "polyline", "polygon",
+	"text", "tspan", "textpath",
+	"lineargradient", "radialgradient", "stop", "pattern", "clippath", "mask", "marker",
+	"filter", "feblend", "fecolormatrix", "fecomponenttransfer", "fecomposite",
+	"feconvolvematrix", "fediffuselighting", "fedisplacementmap", "fedistantlight",
+	"fedropshadow", "feflood", "fefunca", "fefuncb", "fefuncg", "fefuncr",
+	"fegaussianblur", "femerge", "femergenode", "femorphology", "feoffset",
+	"fepointlight", "fespecularlighting", "fespotlight", "fetile", "feturbulence",
+)
+
+// Разрешенные атрибуты без префикса (имена в нижнем регистре): геометрия и оформление.
+// Обработчики событий (on*), attributeName и прочие атрибуты анимаций сюда не входят.
+var svgAllowedAttrs = allowSet(
+	"id", "class", "style", "lang", "tabindex", "version", "xmlns", "href",
+	"x", "y", "x1", "y1", "x2", "y2", "cx", "cy", "r", "rx", "ry", "fx", "fy", "fr",
+	"width", "height", "d", "points", "pathlength", "viewbox", "preserveaspectratio", "transform",
+	"fill", "fill-opacity", "fill-rule", "stroke", "stroke-width", "stroke-linecap",
+	"stroke-linejoin", "stroke-miterlimit", "stroke-dasharray", "stroke-dashoffset",
+	"stroke-opacity", "opacity", "color", "display", "visibility", "overflow",
+	"clip-path", "clip-rule", "mask", "filter", "vector-effect", "paint-order",
+	"shape-rendering", "text-rendering", "image-rendering", "color-interpolation",
+	"color-interpolation-filters", "mix-blend-mode", "isolation",
+	"font-family", "font-size", "font-weight", "font-style", "font-variant", "font-stretch",
+	"text-anchor", "dominant-baseline", "alignment-baseline", "baseline-shift",
+	"letter-spacing", "word-spacing", "text-decoration", "writing-mode", "direction",
+	"dx", "dy", "rotate", "textlength", "lengthadjust", "startoffset", "method", "spacing", "side",
+	"offset", "stop-color", "stop-opacity", "gradientunits", "gradienttransform", "spreadmethod",
+	"patternunits", "patterncontentunits", "patterntransform",
+	"clippathunits", "maskunits", "maskcontentunits",
+	"markerwidth", "markerheight", "markerunits", "refx", "refy", "orient",
+	"marker-start", "marker-mid", "marker-end",
+	"filterunits", "primitiveunits", "in", "in2", "result", "mode", "operator",
+	"k1", "k2", "k3", "k4", "values", "type", "tablevalues", "slope", "intercept",
+	"amplitude", "exponent", "stddeviation", "edgemode", "radius", "scale",
+	"xchannelselector", "ychannelselector", "flood-color", "flood-opacity", "lighting-color",
+	"basefrequency", "numoctaves", "seed", "stitchtiles", "order", "kernelmatrix",
+	"divisor", "bias", "targetx", "targety", "preservealpha", "kernelunitlength",
+	"surfacescale", "diffuseconstant", "specularconstant", "specularexponent",
+	"azimuth", "elevation", "z", "pointsatx", "pointsaty", "pointsatz", "limitingconeangle",
+)
+
+func allowSet(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// svgElement - открытый элемент: полное имя для проверки закрывающего тега
+// и локальное имя в нижнем регистре
+type svgElement struct {
+	name  string
+	local string
+}
+
+// SanitizeSVG оставляет в SVG только разрешенные элементы и атрибуты, ссылки
+// внутри документа (#id) и CSS без внешних ресурсов; удаляет DOCTYPE, комментарии
+// и инструкции обработки. Возвращает очищенный документ и размеры
+// из width/height или viewBox (0, если их нет).
+func SanitizeSVG(data []byte) ([]byte, int, int, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = true
+
+	var (
+		out      bytes.Buffer
+		stack    []svgElement // открытые элементы
+		skip     int          // глубина внутри удаляемого элемента
+		root     bool
+		width    int
+		height   int
+		prefixes = map[string]bool{} // префиксы, объявленные для пространства имен SVG
+	)
+	out.WriteString(xml.Header)
+
+	for {
+		// RawToken не переписывает префиксы пространств имен, документ сохраняется как есть
+		tok, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("%w: invalid svg: %v", ErrUnsupported, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			el := svgElement{name: qualifiedName(t.Name), local: strings.ToLower(t.Name.Local)}
+			if !root {
+				if el.local != "svg" {
+					return nil, 0, 0, fmt.Errorf("%w: root element is %s, not svg", ErrUnsupported, el.name)
+				}
+				root = true
+				width, height = svgSize(t.Attr)
+			} else if len(stack) == 0 {
+				return nil, 0, 0, fmt.Errorf("%w: invalid svg: several root elements", ErrUnsupported)
+			}
+			stack = append(stack, el)
+
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" && a.Value == svgNamespace {
+					prefixes[a.Name.Local] = true
+				}
+			}
+			allowed := svgAllowedElements[el.local] && (t.Name.Space == "" || prefixes[t.Name.Space])
+			if skip > 0 || !allowed {
+				skip++
+				continue
+			}
+
+			out.WriteString("<" + el.name)
+			for _, a := range t.Attr {
+				if !safeSVGAttr(a) {
+					continue
+				}
+				out.WriteString(" " + qualifiedName(a.Name) + `="`)
+				xml.EscapeText(&out, []byte(a.Value))
+				out.WriteString(`"`)
+			}
+			out.WriteString(">")
+
+		case xml.EndElement:
+			name := qualifiedName(t.Name)
+			if len(stack) == 0 || stack[len(stack)-1].name != name {
+				return nil, 0, 0, fmt.Errorf("%w: invalid svg: unexpected </%s>", ErrUnsupported, name)
+			}
+			stack = stack[:len(stack)-1]
+
+			if skip > 0 {
+				skip--
+				continue
+			}
+			out.WriteString("</" + name + ">")
+
+		case xml.CharData:
+			if skip == 0 && len(stack) > 0 {
+				// В <style> (и <svg:style>) нельзя подгружать внешние ресурсы
+				if stack[len(stack)-1].local == "style" && unsafeCSS(string(t)) {
+					continue
+				}
+				xml.EscapeText(&out, t)
+			}
+
+		default:
+			// Комментарии, DOCTYPE (сущности) и инструкции обработки не сохраняем
+		}
+	}
+
+	if !root {
+		return nil, 0, 0, fmt.Errorf("%w: no svg element", ErrUnsupported)
+	}
+	if len(stack) > 0 {
+		return nil, 0, 0, fmt.Errorf("%w: invalid svg: unclosed <%s>", ErrUnsupported, stack[len(stack)-1].name)
+	}
+	return out.Bytes(), width, height, nil
+}
+
+func qualifiedName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+// safeSVGAttr пропускает только разрешенные атрибуты без ссылок за пределы документа
+func safeSVGAttr(a xml.Attr) bool {
+	local := strings.ToLower(a.Name.Local)
+	value := compactValue(a.Value)
+
+	switch a.Name.Space {
+	case "":
+		if local == "xmlns" {
+			return a.Value == svgNamespace
+		}
+		if !svgAllowedAttrs[local] {
+			return false
+		}
+	case "xmlns":
+		return a.Value == svgNamespace || a.Value == xlinkNamespace
+	case "xlink":
+		if local != "href" {
+			return false
+		}
+	case "xml":
+		return local == "space" || local == "lang"
+	default:
+		return false
+	}
+
+	switch local {
+	case "href":
+		// Разрешены только ссылки на элементы этого же документа: <use href="#icon">
+		return strings.HasPrefix(value, "#")
+	case "style":
+		return !unsafeCSS(a.Value)
+	}
+	return !strings.Contains(value, "javascript:") && !externalURL(value)
+}
+
+// compactValue - значение в нижнем регистре без пробельных и управляющих символов:
+// браузеры удаляют их из URL, и "java\tscript:" работает как "javascript:"
+func compactValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
+
+// externalURL - в значении есть url(...), указывающий не на элемент документа
+func externalURL(value string) bool {
+	for {
+		i := strings.Index(value, "url(")
+		if i < 0 {
+			return false
+		}
+		value = strings.TrimLeft(value[i+len("url("):], `"'`)
+		if !strings.HasPrefix(value, "#") {
+			return true
+		}
+	}
+}
+
+// unsafeCSS - CSS, который может подгрузить внешний ресурс или выполнить код.
+// Экранирование (\) запрещено целиком, иначе им можно спрятать url( и @import.
+func unsafeCSS(css string) bool {
+	css = compactValue(css)
+	return externalURL(css) || strings.Contains(css, "@import") || strings.Contains(css, "\\") ||
+		strings.Contains(css, "expression(") || strings.Contains(css, "javascript:")
+}
+
+// svgSize берет размеры из width/height, а если их нет - из viewBox
+func svgSize(attrs []xml.Attr) (int, int) {
+	var width, height, viewBox string
+	for _, a := range attrs {
+		if a.Name.Space != "" {
+			continue
+		}
+		switch a.Name.Local {
+		case "width":
+			width = a.Value
+		case "height":
+			height = a.Value
+		case "viewBox":
+			viewBox = a.Value
+		}
+	}
+
+	w, wok := svgLength(width)
+	h, hok := svgLength(height)
+	if wok && hok {
+		return w, h
+	}
+
+	fields := strings.FieldsFunc(viewBox, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(fields) == 4 {
+		w, wok = svgLength(fields[2])
+		h, hok = svgLength(fields[3])
+		if wok && hok {
+			return w, h
+		}
+	}
+	return 0, 0
+}
+
+// svgLength понимает числа без единиц и в px; проценты и прочие единицы - нет
+func svgLength(s string) (int, bool) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "px")
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 || v > math.MaxInt32 {
+		return 0, false
+	}
+	return int(math.Round(v)), true
+}
@@ -0,0 +1,68 @@
+package images
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"path"
+	"strings"
+
+	"github.com/gen2brain/webp"
+	"golang.org/x/image/draw"
+)
+
+// VariantWidths - ширины уменьшенных копий для srcset, px
+var VariantWidths = []int{160, 480, 1024}
+
+// webpQuality - качество WebP-копий (сжатие с потерями, прозрачность сохраняется)
+const webpQuality = 80
+
+// Variant - уменьшенная копия картинки, готовая к сохранению
+type Variant struct {
+	Width  int
+	Height int
+	Format Format
+	Data   []byte
+}
+
+// Variants уменьшает картинку до каждой из ширин с сохранением пропорций
+// и кодирует копии в WebP. Ширины, не меньшие исходной, пропускаются:
+// увеличивать картинку незачем, в srcset ее заменит оригинал.
+func Variants(src image.Image, widths []int) ([]Variant, error) {
+	bounds := src.Bounds()
+
+	var variants []Variant
+	for _, width := range widths {
+		if width <= 0 || width >= bounds.Dx() {
+			continue
+		}
+
+		resized := Resize(src, width)
+		var buf bytes.Buffer
+		if err := webp.Encode(&buf, resized, webp.Options{Quality: webpQuality}); err != nil {
+			return nil, fmt.Errorf("encode %dpx variant: %w", width, err)
+		}
+		variants = append(variants, Variant{
+			Width:  resized.Bounds().Dx(),
+			Height: resized.Bounds().Dy(),
+			Format: WebP,
+			Data:   buf.Bytes(),
+		})
+	}
+	return variants, nil
+}
+
+// Resize уменьшает картинку до заданной ширины с сохранением пропорций
+func Resize(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+// VariantKey - ключ копии рядом с оригиналом: device_1_1700000000.png -> device_1_1700000000_w160.webp
+func VariantKey(source string, v Variant) string {
+	return fmt.Sprintf("%s_w%d%s", strings.TrimSuffix(source, path.Ext(source)), v.Width, v.Format.Ext)
+}
@@ -2,26 +2,45 @@ package middleware
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
+	"net"
 	"net/http"
 	"time"
 
+	"smartdevices/internal/apperr"
+	"smartdevices/internal/config"
 	"smartdevices/internal/models"
+	"smartdevices/internal/password"
 	"smartdevices/internal/session"
+	"smartdevices/internal/validate"
 
 	"golang.org/x/net/context"
 	"gorm.io/gorm"
 )
 
+// lastSeenInterval - как часто обновлять время последней активности сессии
+const lastSeenInterval = time.Minute
+
+// ErrInvalidCredentials - неверный логин или пароль
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
 type AuthMiddleware struct {
 	db             *gorm.DB
 	sessionManager *session.Manager
+	cfg            config.SessionConfig
+}
+
+func NewAuthMiddleware(db *gorm.DB, cfg config.Config) *AuthMiddleware {
+	return NewAuthMiddlewareWithSessions(db, cfg, session.NewSessionManager(cfg))
 }
 
-func NewAuthMiddleware(db *gorm.DB) *AuthMiddleware {
+// NewAuthMiddlewareWithSessions создает middleware с заданным менеджером сессий
+// (например, поверх session.MemoryStore в тестах)
+func NewAuthMiddlewareWithSessions(db *gorm.DB, cfg config.Config, sessionManager *session.Manager) *AuthMiddleware {
 	return &AuthMiddleware{
 		db:             db,
-		sessionManager: session.NewSessionManager(),
+		sessionManager: sessionManager,
+		cfg:            cfg.Session,
 	}
 }
 
@@ -35,16 +54,25 @@ func (a *AuthMiddleware) GetSession(r *http.Request) (*session.Session, error) {
 	return a.sessionManager.GetSession(cookie.Value)
 }
 
-// CreateSession создает новую сессию
-func (a *AuthMiddleware) CreateSession(client models.Client) (string, error) {
-	sessionID := fmt.Sprintf("%d-%d", client.ID, time.Now().Unix())
+// CreateSession создает новую сессию со случайным токеном
+func (a *AuthMiddleware) CreateSession(client models.Client, r *http.Request) (string, error) {
+	sessionID, err := session.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	session := session.Session{
 		ClientID:    client.ID,
 		Username:    client.Username,
 		IsModerator: client.IsModerator,
+		CreatedAt:   now,
+		LastSeen:    now,
+		UserAgent:   r.UserAgent(),
+		IP:          clientIP(r),
 	}
 
-	err := a.sessionManager.CreateSession(sessionID, session, 24*time.Hour)
+	err = a.sessionManager.CreateSession(sessionID, session, a.cfg.TTL)
 	if err != nil {
 		return "", err
 	}
@@ -52,6 +80,78 @@ func (a *AuthMiddleware) CreateSession(client models.Client) (string, error) {
 	return sessionID, nil
 }
 
+// StartSession выдает клиенту новую сессию и куку.
+// Прежняя сессия из куки удаляется - идентификатор меняется при каждом входе
+// и при изменении прав.
+func (a *AuthMiddleware) StartSession(w http.ResponseWriter, r *http.Request, client models.Client) error {
+	if cookie, err := r.Cookie("session_id"); err == nil {
+		a.sessionManager.DeleteSession(cookie.Value)
+	}
+
+	sessionID, err := a.CreateSession(client, r)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_id",
+		Value:    sessionID,
+		Path:     "/",
+		MaxAge:   int(a.cfg.TTL.Seconds()),
+		HttpOnly: true,
+		Secure:   a.cfg.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+// ClientPrivilegesChanged сбрасывает все сессии клиента после изменения его прав.
+// Если права изменил сам клиент - для текущего запроса выдается новая сессия,
+// остальные его устройства входят заново.
+func (a *AuthMiddleware) ClientPrivilegesChanged(w http.ResponseWriter, r *http.Request, client models.Client) error {
+	current := a.GetCurrentUser(r)
+
+	if _, err := a.sessionManager.DeleteClientSessions(client.ID); err != nil {
+		return err
+	}
+
+	if current != nil && current.ClientID == client.ID {
+		return a.StartSession(w, r, client)
+	}
+	return nil
+}
+
+// RevokeClientSessions завершает все сессии клиента (выход на всех устройствах)
+func (a *AuthMiddleware) RevokeClientSessions(clientID uint) (int, error) {
+	return a.sessionManager.DeleteClientSessions(clientID)
+}
+
+// Authenticate проверяет логин и пароль пользователя.
+// Пароли, сохраненные открытым текстом, при успешном входе заменяются на хэш.
+func (a *AuthMiddleware) Authenticate(username, plain string) (*models.Client, error) {
+	var client models.Client
+	result := a.db.Where("username = ? AND is_active = ?", username, true).First(&client)
+	if result.Error != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	ok, needsRehash := password.Verify(client.Password, plain)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	if needsRehash {
+		hash, err := password.Hash(plain)
+		if err == nil {
+			a.db.Model(&client).Update("password", hash)
+			client.Password = hash
+		}
+	}
+
+	return &client, nil
+}
+
 // DeleteSession удаляет сессию
 func (a *AuthMiddleware) DeleteSession(sessionID string) error {
 	return a.sessionManager.DeleteSession(sessionID)
@@ -71,10 +171,17 @@ func (a *AuthMiddleware) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		session, err := a.GetSession(r)
 		if err != nil {
-			http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+			apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
 			return
 		}
 
+		// Обновляем время последней активности (не чаще раза в минуту)
+		if time.Since(session.LastSeen) > lastSeenInterval {
+			session.LastSeen = time.Now()
+			cookie, _ := r.Cookie("session_id")
+			a.sessionManager.TouchSession(cookie.Value, *session)
+		}
+
 		// Добавляем информацию о пользователе в контекст
 		ctx := context.WithValue(r.Context(), "user", session)
 		next(w, r.WithContext(ctx))
@@ -86,7 +193,7 @@ func (a *AuthMiddleware) RequireModerator(next http.HandlerFunc) http.HandlerFun
 	return a.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
 		user := a.GetCurrentUser(r)
 		if user == nil || !user.IsModerator {
-			http.Error(w, `{"error": "Moderator access required"}`, http.StatusForbidden)
+			apperr.Write(w, r, apperr.Forbidden("Moderator access required"))
 			return
 		}
 		next(w, r)
@@ -95,49 +202,29 @@ func (a *AuthMiddleware) RequireModerator(next http.HandlerFunc) http.HandlerFun
 
 // Login обрабатывает аутентификацию
 func (a *AuthMiddleware) Login(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+		Username string `json:"username" validate:"required,max=150"`
+		Password string `json:"password" validate:"required,maxbytes=72"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := validate.DecodeJSON(w, r, &req); err != nil {
+		apperr.Write(w, r, err)
 		return
 	}
 
-	// Ищем пользователя в БД
-	var client models.Client
-	result := a.db.Where("username = ? AND password = ? AND is_active = ?",
-		req.Username, req.Password, true).First(&client)
-
-	if result.Error != nil {
-		http.Error(w, `{"error": "Invalid credentials"}`, http.StatusUnauthorized)
+	// Ищем пользователя в БД и проверяем пароль
+	client, err := a.Authenticate(req.Username, req.Password)
+	if err != nil {
+		apperr.Write(w, r, apperr.InvalidCredentials())
 		return
 	}
 
-	// Создаем сессию
-	sessionID, err := a.CreateSession(client)
-	if err != nil {
-		http.Error(w, `{"error": "Session creation failed"}`, http.StatusInternalServerError)
+	// Создаем сессию и устанавливаем куки
+	if err := a.StartSession(w, r, *client); err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
 		return
 	}
 
-	// Устанавливаем куки
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    sessionID,
-		Path:     "/",
-		MaxAge:   86400, // 24 часа
-		HttpOnly: true,
-		Secure:   false, // true в production
-		SameSite: http.SameSiteLaxMode,
-	})
-
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"user": map[string]interface{}{
@@ -171,11 +258,22 @@ func (a *AuthMiddleware) Logout(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// clientIP возвращает адрес клиента с учетом прокси nginx
+func clientIP(r *http.Request) string {
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
 // GetSessionInfo возвращает информацию о текущей сессии
 func (a *AuthMiddleware) GetSessionInfo(w http.ResponseWriter, r *http.Request) {
 	session, err := a.GetSession(r)
 	if err != nil {
-		http.Error(w, `{"error": "Not authenticated"}`, http.StatusUnauthorized)
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
 		return
 	}
 
@@ -188,7 +286,7 @@ func (a *AuthMiddleware) GetSessionInfo(w http.ResponseWriter, r *http.Request)
 func (a *AuthMiddleware) GetAllSessions(w http.ResponseWriter, r *http.Request) {
 	sessions, err := a.sessionManager.GetAllSessions()
 	if err != nil {
-		http.Error(w, `{"error": "Failed to get sessions"}`, http.StatusInternalServerError)
+		apperr.Write(w, r, apperr.Internal(err))
 		return
 	}
 
@@ -196,3 +294,98 @@ func (a *AuthMiddleware) GetAllSessions(w http.ResponseWriter, r *http.Request)
 		"sessions": sessions,
 	})
 }
+
+// sessionInfo - сессия в списке сессий пользователя
+type sessionInfo struct {
+	ID      string `json:"id"`
+	Current bool   `json:"current"`
+	session.Session
+}
+
+// GetMySessions возвращает сессии текущего пользователя
+func (a *AuthMiddleware) GetMySessions(w http.ResponseWriter, r *http.Request) {
+	user := a.GetCurrentUser(r)
+	if user == nil {
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
+		return
+	}
+
+	sessions, err := a.sessionManager.GetClientSessions(user.ClientID)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	currentID := ""
+	if cookie, err := r.Cookie("session_id"); err == nil {
+		currentID = session.HashToken(cookie.Value)
+	}
+
+	response := []sessionInfo{}
+	for id, s := range sessions {
+		response = append(response, sessionInfo{ID: id, Current: id == currentID, Session: s})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessions": response,
+	})
+}
+
+// RevokeMySession завершает одну из сессий текущего пользователя
+func (a *AuthMiddleware) RevokeMySession(w http.ResponseWriter, r *http.Request) {
+	user := a.GetCurrentUser(r)
+	if user == nil {
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
+		return
+	}
+
+	id := r.PathValue("id")
+	owns, err := a.sessionManager.ClientOwnsSession(user.ClientID, id)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+	if !owns {
+		apperr.Write(w, r, apperr.NotFound("Session not found"))
+		return
+	}
+
+	if err := a.sessionManager.DeleteSessionByID(id); err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll завершает все сессии текущего пользователя
+func (a *AuthMiddleware) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	user := a.GetCurrentUser(r)
+	if user == nil {
+		apperr.Write(w, r, apperr.Unauthorized("Authentication required"))
+		return
+	}
+
+	revoked, err := a.RevokeClientSessions(user.ClientID)
+	if err != nil {
+		apperr.Write(w, r, apperr.Internal(err))
+		return
+	}
+
+	// Очищаем куки
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_id",
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"revoked": revoked,
+		"message": "Logged out from all devices",
+	})
+}
@@ -2,15 +2,16 @@ package middleware
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
+
+	"smartdevices/internal/apperr"
 )
 
 // GetUsersInfo возвращает информацию о пользователях через Lua скрипт
 func (a *AuthMiddleware) GetUsersInfo(w http.ResponseWriter, r *http.Request) {
 	usersInfo, err := a.sessionManager.GetUsersInfo()
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error": "Failed to get users info: %v"}`, err), http.StatusInternalServerError)
+		apperr.Write(w, r, apperr.Internal(err))
 		return
 	}
 
@@ -25,7 +26,7 @@ func (a *AuthMiddleware) GetUsersInfo(w http.ResponseWriter, r *http.Request) {
 func (a *AuthMiddleware) GetSessionStats(w http.ResponseWriter, r *http.Request) {
 	stats, err := a.sessionManager.GetSessionStats()
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error": "Failed to get session stats: %v"}`, err), http.StatusInternalServerError)
+		apperr.Write(w, r, apperr.Internal(err))
 		return
 	}
 
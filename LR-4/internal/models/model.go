@@ -15,6 +15,16 @@ type Client struct {
 	DateJoined  time.Time  `gorm:"autoCreateTime" json:"date_joined"`
 }
 
+// DeviceType (table: device_types) - тип устройства (хаб, датчик, лампа, ...).
+// Коэффициент трафика берется из типа, а не из названия устройства.
+type DeviceType struct {
+	ID                 uint      `gorm:"primaryKey" json:"id"`
+	Code               string    `gorm:"uniqueIndex;size:50;not null" json:"code"`
+	Name               string    `gorm:"size:100;not null" json:"name"`
+	TrafficCoefficient float64   `gorm:"not null;default:1" json:"traffic_coefficient"`
+	CreatedAt          time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
 // SmartDevice (table: smart_devices) - умные устройства
 type SmartDevice struct {
 	ID             uint      `gorm:"primaryKey" json:"id"`
@@ -28,6 +38,9 @@ type SmartDevice struct {
 	Protocol       string    `gorm:"size:50" json:"protocol"`
 	IsActive       bool      `gorm:"default:true" json:"is_active"`
 	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	DeviceTypeID *uint       `gorm:"index" json:"device_type_id"`
+	DeviceType   *DeviceType `gorm:"foreignKey:DeviceTypeID;constraint:OnDelete:RESTRICT" json:"device_type,omitempty"`
 }
 
 // SmartOrder (table: smart_orders) - заявки на установку
@@ -45,6 +58,7 @@ type SmartOrder struct {
 
 	Address      string  `gorm:"size:500" json:"address"`
 	TotalTraffic float64 `json:"total_traffic"`
+	RejectReason string  `gorm:"size:500" json:"reject_reason,omitempty"`
 }
 
 // OrderItem (table: order_items) - устройства в заявке
@@ -54,6 +68,52 @@ type OrderItem struct {
 	Quantity  int       `gorm:"default:1;not null" json:"quantity"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 
+	// Заполняются при завершении заявки: коэффициент типа и итоговый трафик позиции
+	TrafficCoefficient *float64 `json:"traffic_coefficient,omitempty"`
+	Traffic            *float64 `json:"traffic,omitempty"`
+
 	Order  SmartOrder  `gorm:"foreignKey:OrderID;constraint:OnDelete:RESTRICT" json:"order"`
 	Device SmartDevice `gorm:"foreignKey:DeviceID;constraint:OnDelete:RESTRICT" json:"device"`
 }
+
+// OrderEvent (table: order_events) - история изменений заявки
+type OrderEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OrderID   uint      `gorm:"index;not null" json:"order_id"`
+	ActorID   uint      `gorm:"not null" json:"actor_id"`
+	Actor     Client    `gorm:"foreignKey:ActorID;constraint:OnDelete:RESTRICT" json:"actor"`
+	Type      string    `gorm:"type:varchar(20);not null;check:type IN ('status','field')" json:"type"`
+	Field     string    `gorm:"size:50;not null" json:"field"`
+	OldValue  string    `gorm:"type:text" json:"old_value"`
+	NewValue  string    `gorm:"type:text" json:"new_value"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	Order SmartOrder `gorm:"foreignKey:OrderID;constraint:OnDelete:RESTRICT" json:"-"`
+}
+
+// DeviceImage (table: device_images) - галерея устройства. Главная картинка
+// (не больше одной на устройство) дублируется в SmartDevice.NamespaceURL.
+type DeviceImage struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	DeviceID  uint      `gorm:"not null;index;uniqueIndex:idx_device_images_primary,where:is_primary" json:"device_id"`
+	Key       string    `gorm:"size:500;not null;uniqueIndex" json:"-"` // ключ объекта в хранилище
+	URL       string    `gorm:"size:500;not null" json:"url"`
+	AltText   string    `gorm:"size:300" json:"alt_text"`
+	Position  int       `gorm:"not null;default:0" json:"position"`
+	IsPrimary bool      `gorm:"not null;default:false" json:"is_primary"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	Device SmartDevice `gorm:"foreignKey:DeviceID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// ImageVariant (table: image_variants) - размеры загруженной картинки для srcset.
+// Строка с Key = SourceKey описывает сам оригинал, остальные - его уменьшенные копии.
+type ImageVariant struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	SourceKey   string    `gorm:"size:500;not null;index" json:"source_key"` // ключ оригинала в хранилище
+	Key         string    `gorm:"size:500;not null;uniqueIndex" json:"key"`
+	Width       int       `gorm:"not null" json:"width"`
+	Height      int       `gorm:"not null" json:"height"`
+	ContentType string    `gorm:"size:50;not null" json:"content_type"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
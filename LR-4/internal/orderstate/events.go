@@ -0,0 +1,65 @@
+package orderstate
+
+import (
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Типы записей истории заявки
+const (
+	EventStatus = "status" // смена статуса
+	EventField  = "field"  // изменение поля
+)
+
+// StatusEvent создает запись о смене статуса заявки
+func StatusEvent(order models.SmartOrder, oldStatus string, actorID uint) models.OrderEvent {
+	return models.OrderEvent{
+		OrderID:  order.ID,
+		ActorID:  actorID,
+		Type:     EventStatus,
+		Field:    "status",
+		OldValue: oldStatus,
+		NewValue: order.Status,
+	}
+}
+
+// FieldEvent создает запись об изменении поля заявки
+func FieldEvent(order models.SmartOrder, field, oldValue, newValue string, actorID uint) models.OrderEvent {
+	return models.OrderEvent{
+		OrderID:  order.ID,
+		ActorID:  actorID,
+		Type:     EventField,
+		Field:    field,
+		OldValue: oldValue,
+		NewValue: newValue,
+	}
+}
+
+// SaveWithEvents сохраняет заявку и записи истории в одной транзакции.
+// fromStatus - статус, в котором заявку проверили перед изменением: если другой
+// запрос успел его сменить, ничего не сохраняется и возвращается ErrConflict.
+func SaveWithEvents(db *gorm.DB, order *models.SmartOrder, fromStatus string, events ...models.OrderEvent) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.SmartOrder{}).
+			Where("id = ? AND status = ?", order.ID, fromStatus).
+			Select("*").Omit("id", "created_at", clause.Associations).
+			Updates(order)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrConflict
+		}
+
+		for _, event := range events {
+			event.OrderID = order.ID
+			if err := tx.Create(&event).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,125 @@
+package orderstate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"smartdevices/internal/models"
+)
+
+// Статусы заявки
+const (
+	StatusDraft     = "draft"
+	StatusDeleted   = "deleted"
+	StatusFormed    = "formed"
+	StatusCompleted = "completed"
+	StatusRejected  = "rejected"
+)
+
+// Action - действие над заявкой, переводящее ее в другой статус
+type Action string
+
+const (
+	ActionForm     Action = "form"
+	ActionDelete   Action = "delete"
+	ActionComplete Action = "complete"
+	ActionReject   Action = "reject"
+)
+
+// Role - кто имеет право выполнить переход
+type Role string
+
+const (
+	RoleOwner     Role = "owner"     // создатель заявки
+	RoleModerator Role = "moderator" // модератор
+)
+
+// Transition описывает разрешенный переход между статусами
+type Transition struct {
+	From string
+	To   string
+	Role Role
+}
+
+// transitions - таблица разрешенных переходов
+var transitions = map[Action]Transition{
+	ActionForm:     {From: StatusDraft, To: StatusFormed, Role: RoleOwner},
+	ActionDelete:   {From: StatusDraft, To: StatusDeleted, Role: RoleOwner},
+	ActionComplete: {From: StatusFormed, To: StatusCompleted, Role: RoleModerator},
+	ActionReject:   {From: StatusFormed, To: StatusRejected, Role: RoleModerator},
+}
+
+var (
+	ErrUnknownAction     = errors.New("unknown order action")
+	ErrForbidden         = errors.New("action is not allowed for this user")
+	ErrInvalidTransition = errors.New("invalid order status transition")
+	ErrConflict          = errors.New("order status was changed by another request")
+)
+
+// Actor - пользователь, выполняющий действие
+type Actor struct {
+	ClientID    uint
+	IsModerator bool
+}
+
+func (a Actor) hasRole(order models.SmartOrder, role Role) bool {
+	switch role {
+	case RoleOwner:
+		return order.ClientID == a.ClientID
+	case RoleModerator:
+		return a.IsModerator
+	}
+	return false
+}
+
+// Can проверяет, может ли пользователь выполнить действие над заявкой
+func Can(order models.SmartOrder, action Action, actor Actor) error {
+	t, ok := transitions[action]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownAction, action)
+	}
+
+	if !actor.hasRole(order, t.Role) {
+		return fmt.Errorf("%w: %s requires role %s", ErrForbidden, action, t.Role)
+	}
+
+	if order.Status != t.From {
+		return fmt.Errorf("%w: cannot %s order in status %q", ErrInvalidTransition, action, order.Status)
+	}
+
+	return nil
+}
+
+// Apply выполняет переход и проставляет связанные с ним поля заявки
+func Apply(order *models.SmartOrder, action Action, actor Actor) error {
+	if err := Can(*order, action, actor); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	switch action {
+	case ActionForm:
+		order.FormedAt = &now
+	case ActionComplete, ActionReject:
+		moderatorID := actor.ClientID
+		order.CompletedAt = &now
+		order.ModeratorID = &moderatorID
+	}
+
+	order.Status = transitions[action].To
+	return nil
+}
+
+// CanEdit проверяет, можно ли менять поля заявки (только черновик и только создателю)
+func CanEdit(order models.SmartOrder, actor Actor) error {
+	if !actor.hasRole(order, RoleOwner) {
+		return fmt.Errorf("%w: only owner can edit order", ErrForbidden)
+	}
+
+	if order.Status != StatusDraft {
+		return fmt.Errorf("%w: cannot edit order in status %q", ErrInvalidTransition, order.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package orderstate
+
+import "gorm.io/gorm"
+
+// draftSchema - у клиента не больше одного черновика. Лишние черновики, созданные
+// до появления индекса, помечаются удаленными (остается самый новый).
+var draftSchema = []string{
+	`UPDATE smart_orders SET status = 'deleted'
+		WHERE status = 'draft' AND id NOT IN (
+			SELECT max(id) FROM smart_orders WHERE status = 'draft' GROUP BY client_id
+		)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_smart_orders_draft ON smart_orders (client_id) WHERE status = 'draft'`,
+}
+
+// MigrateDrafts создает уникальный индекс черновиков (повторный запуск безопасен)
+func MigrateDrafts(db *gorm.DB) error {
+	for _, stmt := range draftSchema {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
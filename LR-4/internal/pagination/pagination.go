@@ -0,0 +1,318 @@
+package pagination
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"smartdevices/internal/apperr"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 100
+)
+
+// Field - поле, по которому разрешена сортировка. Value нужен для курсора:
+// он достает значение поля из последней записи страницы.
+// Колонка должна быть NOT NULL, иначе сравнение в курсоре теряет строки.
+type Field[T any] struct {
+	Column string
+	Value  func(T) any
+}
+
+// Spec - правила пагинации списка: белый список полей сортировки и сортировка по умолчанию.
+// Поле "id" обязательно - оно добавляется последним для однозначного порядка.
+type Spec[T any] struct {
+	Fields  map[string]Field[T]
+	Default string // например "-created_at"
+}
+
+// SortField - одно поле сортировки из параметра sort=name,-created_at
+type SortField struct {
+	Name string
+	Desc bool
+}
+
+// Params - разобранные параметры запроса
+type Params[T any] struct {
+	spec   Spec[T]
+	Limit  int
+	Offset int
+	Sort   []SortField
+	cursor []any // значения полей сортировки последней записи предыдущей страницы
+	ranked bool
+}
+
+// Page - сведения о полученной странице
+type Page struct {
+	Total      int64
+	Limit      int
+	Offset     int
+	NextCursor string // пусто, если это последняя страница или курсор не использовался
+	cursorMode bool
+	count      int
+}
+
+// Parse читает limit, offset, cursor и sort из строки запроса
+func Parse[T any](r *http.Request, spec Spec[T]) (Params[T], error) {
+	q := r.URL.Query()
+	p := Params[T]{spec: spec, Limit: DefaultLimit}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			return p, invalid("limit", fmt.Sprintf("limit must be between 1 and %d", MaxLimit))
+		}
+		p.Limit = limit
+	}
+
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return p, invalid("offset", "offset must be a non-negative integer")
+		}
+		p.Offset = offset
+	}
+
+	sortParam := q.Get("sort")
+	if sortParam == "" {
+		sortParam = spec.Default
+	}
+	sort, err := parseSort(sortParam, spec)
+	if err != nil {
+		return p, err
+	}
+	p.Sort = sort
+
+	if v := q.Get("cursor"); v != "" {
+		if p.Offset > 0 {
+			return p, invalid("cursor", "cursor and offset cannot be used together")
+		}
+		values, err := decodeCursor(v, len(p.Sort))
+		if err != nil {
+			return p, invalid("cursor", "invalid cursor")
+		}
+		p.cursor = values
+	}
+
+	return p, nil
+}
+
+func parseSort[T any](param string, spec Spec[T]) ([]SortField, error) {
+	var sort []SortField
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(param, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		f := SortField{Name: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if _, ok := spec.Fields[f.Name]; !ok {
+			return nil, invalid("sort", fmt.Sprintf("cannot sort by %q, allowed: %s", f.Name, allowed(spec)))
+		}
+		if seen[f.Name] {
+			continue
+		}
+		seen[f.Name] = true
+		sort = append(sort, f)
+	}
+
+	if !seen["id"] {
+		sort = append(sort, SortField{Name: "id"})
+	}
+	return sort, nil
+}
+
+// Ranked отключает сортировку из параметра sort: порядок задает сам запрос
+// (например, релевантность поиска), id добавляется для однозначности.
+// Курсор в этом режиме не поддерживается - только offset.
+func (p Params[T]) Ranked() (Params[T], error) {
+	if p.cursor != nil {
+		return p, invalid("cursor", "cursor is not supported for results ordered by relevance, use offset")
+	}
+	p.ranked = true
+	p.Sort = []SortField{{Name: "id"}}
+	return p, nil
+}
+
+// Query применяет сортировку и пагинацию к запросу, считает общее количество и загружает страницу
+func Query[T any](q *gorm.DB, p Params[T]) ([]T, Page, error) {
+	page := Page{Limit: p.Limit, Offset: p.Offset, cursorMode: p.cursor != nil}
+
+	// Preload к подсчету не относится: связи подгружаются только для страницы
+	counter := q.Session(&gorm.Session{Context: q.Statement.Context})
+	counter.Statement.Preloads = nil
+	if err := counter.Model(new(T)).Count(&page.Total).Error; err != nil {
+		return nil, page, err
+	}
+
+	q = q.Session(&gorm.Session{})
+	for _, f := range p.Sort {
+		order := p.spec.Fields[f.Name].Column
+		if f.Desc {
+			order += " DESC"
+		}
+		q = q.Order(order)
+	}
+
+	if p.cursor != nil {
+		where, args := p.keyset()
+		q = q.Where(where, args...)
+	} else {
+		q = q.Offset(p.Offset)
+	}
+
+	// Берем на одну запись больше, чтобы понять, есть ли следующая страница
+	var items []T
+	if err := q.Limit(p.Limit + 1).Find(&items).Error; err != nil {
+		return nil, page, err
+	}
+
+	if len(items) > p.Limit {
+		items = items[:p.Limit]
+		if !p.ranked {
+			page.NextCursor = p.encodeCursor(items[len(items)-1])
+		}
+	}
+	page.count = len(items)
+
+	return items, page, nil
+}
+
+// keyset строит условие "после записи курсора" для смешанных направлений сортировки:
+// (a > ?) OR (a = ? AND b < ?) OR ...
+func (p Params[T]) keyset() (string, []any) {
+	var (
+		ors  []string
+		args []any
+	)
+
+	for i, f := range p.Sort {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, p.spec.Fields[p.Sort[j].Name].Column+" = ?")
+			args = append(args, p.cursor[j])
+		}
+
+		op := " > ?"
+		if f.Desc {
+			op = " < ?"
+		}
+		ands = append(ands, p.spec.Fields[f.Name].Column+op)
+		args = append(args, p.cursor[i])
+
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+func (p Params[T]) encodeCursor(last T) string {
+	values := make([]any, len(p.Sort))
+	for i, f := range p.Sort {
+		values[i] = p.spec.Fields[f.Name].Value(last)
+	}
+
+	data, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string, n int) ([]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var values []any
+	if err := dec.Decode(&values); err != nil {
+		return nil, err
+	}
+	if len(values) != n {
+		return nil, errors.New("cursor does not match sort")
+	}
+
+	// Целые числа (id, количество) передаем в БД как int64, а не float64
+	for i, v := range values {
+		if num, ok := v.(json.Number); ok {
+			if n, err := num.Int64(); err == nil {
+				values[i] = n
+			} else if f, err := num.Float64(); err == nil {
+				values[i] = f
+			}
+		}
+	}
+	return values, nil
+}
+
+// WriteHeaders сообщает клиенту общее количество и ссылки на соседние страницы:
+// X-Total-Count, X-Next-Cursor и Link (RFC 8288).
+func WriteHeaders(w http.ResponseWriter, r *http.Request, page Page) {
+	h := w.Header()
+	h.Set("X-Total-Count", strconv.FormatInt(page.Total, 10))
+
+	var links []string
+	link := func(rel string, set map[string]string) {
+		u := *r.URL
+		q := u.Query()
+		for k, v := range set {
+			if v == "" {
+				q.Del(k)
+			} else {
+				q.Set(k, v)
+			}
+		}
+		u.RawQuery = q.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel))
+	}
+
+	limit := strconv.Itoa(page.Limit)
+	if page.NextCursor != "" {
+		h.Set("X-Next-Cursor", page.NextCursor)
+	}
+
+	if page.cursorMode {
+		if page.NextCursor != "" {
+			link("next", map[string]string{"cursor": page.NextCursor, "limit": limit})
+		}
+		link("first", map[string]string{"cursor": "", "limit": limit})
+	} else {
+		if int64(page.Offset+page.count) < page.Total {
+			link("next", map[string]string{"offset": strconv.Itoa(page.Offset + page.Limit), "limit": limit})
+		}
+		if page.Offset > 0 {
+			link("prev", map[string]string{"offset": strconv.Itoa(max(page.Offset-page.Limit, 0)), "limit": limit})
+		}
+		link("first", map[string]string{"offset": "", "limit": limit})
+	}
+
+	h.Set("Link", strings.Join(links, ", "))
+}
+
+func invalid(param, message string) error {
+	e := apperr.New(http.StatusBadRequest, apperr.CodeInvalidParameter, "Invalid parameter: "+param)
+	e.Fields = []apperr.FieldError{{Field: param, Code: "invalid", Message: message}}
+	return e
+}
+
+func allowed[T any](spec Spec[T]) string {
+	names := make([]string, 0, len(spec.Fields))
+	for name := range spec.Fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
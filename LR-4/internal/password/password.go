@@ -0,0 +1,45 @@
+package password
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cost - стоимость bcrypt для новых хэшей
+const Cost = bcrypt.DefaultCost
+
+// Hash возвращает bcrypt-хэш пароля
+func Hash(plain string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// IsHashed проверяет, что значение из БД уже является bcrypt-хэшем
+func IsHashed(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") ||
+		strings.HasPrefix(stored, "$2b$") ||
+		strings.HasPrefix(stored, "$2y$")
+}
+
+// Verify сравнивает пароль с сохраненным значением.
+// needsRehash = true, если сохранено открытым текстом или с устаревшей стоимостью -
+// такое значение нужно перехэшировать после успешного входа.
+func Verify(stored, plain string) (ok bool, needsRehash bool) {
+	if !IsHashed(stored) {
+		// Старые записи хранят пароль открытым текстом
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(plain)) == 1
+		return ok, ok
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(stored), []byte(plain)) != nil {
+		return false, false
+	}
+
+	cost, err := bcrypt.Cost([]byte(stored))
+	return true, err == nil && cost < Cost
+}
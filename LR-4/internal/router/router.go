@@ -0,0 +1,152 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Middleware - обертка над обработчиком (совпадает с сигнатурой RequireAuth/RequireModerator)
+type Middleware func(http.HandlerFunc) http.HandlerFunc
+
+// Router - тонкая обертка над http.ServeMux (шаблоны Go 1.22: "GET /items/{id}")
+// с группами маршрутов и цепочками middleware.
+//
+// Несовпадение метода отдает 405 с заголовком Allow, OPTIONS отвечает списком
+// разрешенных методов, завершающий слэш в пути игнорируется.
+type Router struct {
+	*routes
+	prefix      string
+	middlewares []Middleware
+}
+
+// routes - общее состояние корневого роутера и всех его групп
+type routes struct {
+	mux      *http.ServeMux
+	methods  map[string]struct{}
+	notFound http.HandlerFunc
+	wrap     []func(http.Handler) http.Handler
+}
+
+func New() *Router {
+	return &Router{
+		routes: &routes{
+			mux:      http.NewServeMux(),
+			methods:  make(map[string]struct{}),
+			notFound: http.NotFound,
+		},
+	}
+}
+
+// NotFound задает обработчик для путей, которым не соответствует ни один маршрут
+func (r *Router) NotFound(h http.HandlerFunc) {
+	r.notFound = h
+}
+
+// Wrap добавляет обертку над всем роутером, включая 404/405 и OPTIONS (например, CORS)
+func (r *Router) Wrap(w func(http.Handler) http.Handler) {
+	r.wrap = append(r.wrap, w)
+}
+
+// Group создает группу маршрутов с общим префиксом и middleware
+func (r *Router) Group(prefix string, mws ...Middleware) *Router {
+	return &Router{
+		routes:      r.routes,
+		prefix:      r.prefix + prefix,
+		middlewares: append(append([]Middleware{}, r.middlewares...), mws...),
+	}
+}
+
+// With возвращает группу с тем же префиксом и дополнительными middleware
+func (r *Router) With(mws ...Middleware) *Router {
+	return r.Group("", mws...)
+}
+
+// Handle регистрирует обработчик для метода и пути (путь может содержать {параметры})
+func (r *Router) Handle(method, path string, h http.HandlerFunc) {
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		h = r.middlewares[i](h)
+	}
+
+	r.methods[method] = struct{}{}
+	r.mux.HandleFunc(method+" "+r.prefix+path, h)
+}
+
+func (r *Router) Get(path string, h http.HandlerFunc)    { r.Handle(http.MethodGet, path, h) }
+func (r *Router) Post(path string, h http.HandlerFunc)   { r.Handle(http.MethodPost, path, h) }
+func (r *Router) Put(path string, h http.HandlerFunc)    { r.Handle(http.MethodPut, path, h) }
+func (r *Router) Delete(path string, h http.HandlerFunc) { r.Handle(http.MethodDelete, path, h) }
+
+// Mount регистрирует готовый http.Handler на префикс пути для всех методов
+func (r *Router) Mount(prefix string, h http.Handler) {
+	r.mux.Handle(r.prefix+prefix, h)
+}
+
+// Handler возвращает корневой обработчик со всеми обертками
+func (r *Router) Handler() http.Handler {
+	var h http.Handler = http.HandlerFunc(r.serve)
+	for i := len(r.wrap) - 1; i >= 0; i-- {
+		h = r.wrap[i](h)
+	}
+	return h
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Handler().ServeHTTP(w, req)
+}
+
+func (r *routes) serve(w http.ResponseWriter, req *http.Request) {
+	// /api/smart-devices/1/ == /api/smart-devices/1
+	if p := req.URL.Path; len(p) > 1 && strings.HasSuffix(p, "/") {
+		if _, pattern := r.mux.Handler(req); pattern == "" {
+			req.URL.Path = strings.TrimRight(p, "/")
+			if req.URL.Path == "" {
+				req.URL.Path = "/"
+			}
+			req.URL.RawPath = ""
+		}
+	}
+
+	if _, pattern := r.mux.Handler(req); pattern != "" {
+		r.mux.ServeHTTP(w, req)
+		return
+	}
+
+	allowed := r.allowed(req)
+	switch {
+	case len(allowed) == 0:
+		r.notFound(w, req)
+	case req.Method == http.MethodOptions:
+		w.Header().Set("Allow", strings.Join(append(allowed, http.MethodOptions), ", "))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		// ServeMux сам отвечает 405 и выставляет Allow
+		r.mux.ServeHTTP(w, req)
+	}
+}
+
+// allowed возвращает методы, для которых есть маршрут с путем запроса
+func (r *routes) allowed(req *http.Request) []string {
+	var allowed []string
+	for method := range r.methods {
+		probe := req.Clone(req.Context())
+		probe.Method = method
+		if _, pattern := r.mux.Handler(probe); pattern != "" {
+			allowed = append(allowed, method)
+		}
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// UintParam возвращает параметр пути {name} как положительное число
+func UintParam(r *http.Request, name string) (uint, error) {
+	value := r.PathValue(name)
+	id, err := strconv.ParseUint(value, 10, 0)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid path parameter %s: %q", name, value)
+	}
+	return uint(id), nil
+}
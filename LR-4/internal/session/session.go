@@ -1,94 +1,150 @@
 package session
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 
-	"github.com/redis/go-redis/v9"
-	"golang.org/x/net/context"
+	"smartdevices/internal/config"
 )
 
+// TokenBytes - длина токена сессии (256 бит)
+const TokenBytes = 32
+
+// ErrNotFound - сессия не найдена или истекла
+var ErrNotFound = errors.New("session not found")
+
 type Session struct {
-	ClientID    uint   `json:"client_id"`
-	Username    string `json:"username"`
-	IsModerator bool   `json:"is_moderator"`
+	ClientID    uint      `json:"client_id"`
+	Username    string    `json:"username"`
+	IsModerator bool      `json:"is_moderator"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastSeen    time.Time `json:"last_seen"`
+	UserAgent   string    `json:"user_agent"`
+	IP          string    `json:"ip"`
+}
+
+// Store - хранилище сессий. Идентификатор сессии - хэш токена из куки.
+type Store interface {
+	Create(id string, session Session, expiration time.Duration) error
+	Get(id string) (*Session, error)
+	// Touch перезаписывает данные сессии, не меняя TTL
+	Touch(id string, session Session) error
+	Delete(id string) error
+	DeleteClient(clientID uint) (int, error)
+	ClientSessions(clientID uint) (map[string]Session, error)
+	AllSessions() (map[string]Session, error)
+	ClientOwns(clientID uint, id string) (bool, error)
+	UsersInfo() (map[string]interface{}, error)
+	Stats() (map[string]interface{}, error)
+	Ping(ctx context.Context) error
+	Close() error
 }
 
 type Manager struct {
-	client *redis.Client
-	ctx    context.Context
+	store Store
 }
 
-func NewSessionManager() *Manager {
-	client := redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
-		Password: "password",
-		DB:       0,
-	})
+// NewToken генерирует случайный токен сессии для куки
+func NewToken() (string, error) {
+	buf := make([]byte, TokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
 
-	ctx := context.Background()
+// HashToken возвращает хэш токена - в хранилище попадает только он
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
-	// Проверяем подключение
-	_, err := client.Ping(ctx).Result()
-	if err != nil {
-		fmt.Printf("⚠️ Redis connection failed: %v\n", err)
-	} else {
-		fmt.Printf("✅ Redis client initialized successfully\n")
+// NewStore создает хранилище, выбранное в конфигурации (значение проверено config.Validate)
+func NewStore(cfg config.Config) Store {
+	if cfg.Session.Store == "memory" {
+		fmt.Printf("⚠️ Session storage: in-memory (только для разработки и тестов)\n")
+		return NewMemoryStore()
 	}
 
-	return &Manager{
-		client: client,
-		ctx:    ctx,
-	}
+	return NewRedisStore(cfg.Redis)
 }
 
-func (m *Manager) CreateSession(sessionID string, session Session, expiration time.Duration) error {
-	data, err := json.Marshal(session)
-	if err != nil {
-		return err
-	}
+// NewSessionManager создает менеджер с хранилищем из конфигурации
+func NewSessionManager(cfg config.Config) *Manager {
+	return NewManager(NewStore(cfg))
+}
 
-	return m.client.Set(m.ctx, "session:"+sessionID, data, expiration).Err()
+// NewManager создает менеджер поверх готового хранилища
+func NewManager(store Store) *Manager {
+	return &Manager{store: store}
 }
 
-func (m *Manager) GetSession(sessionID string) (*Session, error) {
-	data, err := m.client.Get(m.ctx, "session:"+sessionID).Result()
-	if err != nil {
-		return nil, err
-	}
+// CreateSession сохраняет сессию под хэшем токена
+func (m *Manager) CreateSession(token string, session Session, expiration time.Duration) error {
+	return m.store.Create(HashToken(token), session, expiration)
+}
 
-	var session Session
-	err = json.Unmarshal([]byte(data), &session)
-	if err != nil {
-		return nil, err
-	}
+func (m *Manager) GetSession(token string) (*Session, error) {
+	return m.store.Get(HashToken(token))
+}
+
+// TouchSession обновляет время последней активности, не меняя TTL
+func (m *Manager) TouchSession(token string, session Session) error {
+	return m.store.Touch(HashToken(token), session)
+}
+
+// DeleteSession удаляет сессию по токену из куки
+func (m *Manager) DeleteSession(token string) error {
+	return m.store.Delete(HashToken(token))
+}
+
+// DeleteSessionByID удаляет сессию по ее идентификатору (хэшу токена)
+func (m *Manager) DeleteSessionByID(id string) error {
+	return m.store.Delete(id)
+}
 
-	return &session, nil
+// DeleteClientSessions удаляет все сессии клиента и возвращает их количество
+func (m *Manager) DeleteClientSessions(clientID uint) (int, error) {
+	return m.store.DeleteClient(clientID)
 }
 
-func (m *Manager) DeleteSession(sessionID string) error {
-	return m.client.Del(m.ctx, "session:"+sessionID).Err()
+// GetClientSessions возвращает сессии клиента, ключ - идентификатор сессии
+func (m *Manager) GetClientSessions(clientID uint) (map[string]Session, error) {
+	return m.store.ClientSessions(clientID)
 }
 
+// GetAllSessions возвращает все активные сессии, ключ - идентификатор сессии
 func (m *Manager) GetAllSessions() (map[string]Session, error) {
-	keys, err := m.client.Keys(m.ctx, "session:*").Result()
-	if err != nil {
-		return nil, err
-	}
+	return m.store.AllSessions()
+}
 
-	sessions := make(map[string]Session)
-	for _, key := range keys {
-		data, err := m.client.Get(m.ctx, key).Result()
-		if err != nil {
-			continue
-		}
-
-		var session Session
-		if json.Unmarshal([]byte(data), &session) == nil {
-			sessions[key] = session
-		}
-	}
+// ClientOwnsSession проверяет, что сессия принадлежит клиенту
+func (m *Manager) ClientOwnsSession(clientID uint, id string) (bool, error) {
+	return m.store.ClientOwns(clientID, id)
+}
+
+// GetUsersInfo возвращает информацию о пользователях с активными сессиями
+func (m *Manager) GetUsersInfo() (map[string]interface{}, error) {
+	return m.store.UsersInfo()
+}
+
+// GetSessionStats возвращает статистику по сессиям
+func (m *Manager) GetSessionStats() (map[string]interface{}, error) {
+	return m.store.Stats()
+}
+
+// Ping проверяет доступность хранилища
+func (m *Manager) Ping(ctx context.Context) error {
+	return m.store.Ping(ctx)
+}
 
-	return sessions, nil
+// Close закрывает соединение с хранилищем
+func (m *Manager) Close() error {
+	return m.store.Close()
 }
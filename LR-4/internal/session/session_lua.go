@@ -3,41 +3,157 @@ package session
 import (
 	"encoding/json"
 	"fmt"
+
+	"github.com/redis/go-redis/v9"
 )
 
-// GetUsersInfo возвращает информацию о пользователях через Lua скрипт
-func (m *Manager) GetUsersInfo() (map[string]interface{}, error) {
-	// Lua скрипт для получения всех сессий и преобразования в информацию о пользователях
-	luaScript := `
-		local sessions = {}
-		local keys = redis.call('KEYS', 'session:*')
-		
-		for i, key in ipairs(keys) do
-			local sessionData = redis.call('GET', key)
-			if sessionData then
-				local session = cjson.decode(sessionData)
-				local userInfo = {
-					session_id = key,
-					client_id = session.client_id,
-					username = session.username,
-					is_moderator = session.is_moderator
-				}
-				sessions[i] = userInfo
+// createSessionScript сохраняет сессию и добавляет ее в индексы.
+// KEYS: session:<id>, client_sessions:<client_id>, sessions:all
+// ARGV: данные сессии, TTL в миллисекундах, id
+var createSessionScript = redis.NewScript(`
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	redis.call('SADD', KEYS[2], ARGV[3])
+	redis.call('SADD', KEYS[3], ARGV[3])
+
+	-- Индекс клиента живет не меньше самой долгой его сессии
+	if redis.call('PTTL', KEYS[2]) < tonumber(ARGV[2]) then
+		redis.call('PEXPIRE', KEYS[2], ARGV[2])
+	end
+
+	return 1
+`)
+
+// Все ключи, которых касаются скрипты, передаются в KEYS (требование EVAL и Redis Cluster),
+// поэтому идентификаторы сессий из индексов читаются заранее, а не внутри скрипта.
+
+// deleteSessionScript удаляет сессию и убирает ее из индексов.
+// KEYS: session:<id>, sessions:all[, client_sessions:<client_id>]
+// ARGV: id
+var deleteSessionScript = redis.NewScript(`
+	redis.call('DEL', KEYS[1])
+	redis.call('SREM', KEYS[2], ARGV[1])
+
+	if KEYS[3] then
+		redis.call('SREM', KEYS[3], ARGV[1])
+	end
+
+	return 1
+`)
+
+// deleteClientSessionsScript удаляет сессии клиента.
+// KEYS: client_sessions:<client_id>, sessions:all, session:<id>...
+// ARGV: id... (в том же порядке, что и ключи сессий)
+var deleteClientSessionsScript = redis.NewScript(`
+	local deleted = 0
+
+	for i, id in ipairs(ARGV) do
+		deleted = deleted + redis.call('DEL', KEYS[i + 2])
+		redis.call('SREM', KEYS[1], id)
+		redis.call('SREM', KEYS[2], id)
+	end
+
+	return deleted
+`)
+
+// usersInfoScript собирает информацию о пользователях по сессиям, убирая истекшие из индекса.
+// KEYS: sessions:all, session:<id>...
+// ARGV: id... (в том же порядке, что и ключи сессий)
+var usersInfoScript = redis.NewScript(`
+	local sessions = {}
+
+	for i, id in ipairs(ARGV) do
+		local sessionData = redis.call('GET', KEYS[i + 1])
+		if sessionData then
+			local session = cjson.decode(sessionData)
+			local userInfo = {
+				session_id = id,
+				client_id = session.client_id,
+				username = session.username,
+				is_moderator = session.is_moderator,
+				created_at = session.created_at,
+				last_seen = session.last_seen,
+				user_agent = session.user_agent,
+				ip = session.ip
+			}
+			table.insert(sessions, userInfo)
+		else
+			redis.call('SREM', KEYS[1], id)
+		end
+	end
+
+	return cjson.encode(sessions)
+`)
+
+// statsScript считает сессии модераторов и обычных пользователей.
+// KEYS: session:<id>...
+var statsScript = redis.NewScript(`
+	local total = 0
+	local moderators = 0
+	local regular_users = 0
+
+	for i, key in ipairs(KEYS) do
+		local sessionData = redis.call('GET', key)
+		if sessionData then
+			total = total + 1
+			local session = cjson.decode(sessionData)
+			if session.is_moderator then
+				moderators = moderators + 1
+			else
+				regular_users = regular_users + 1
 			end
 		end
-		
-		return cjson.encode(sessions)
-	`
+	end
+
+	local result = {
+		total_sessions = total,
+		moderators = moderators,
+		regular_users = regular_users
+	}
+
+	return cjson.encode(result)
+`)
 
-	// Выполняем Lua скрипт
-	result, err := m.client.Eval(m.ctx, luaScript, []string{}).Result()
+// indexedSessions читает идентификаторы сессий из индекса и ключи этих сессий
+func (s *RedisStore) indexedSessions(indexKey string) ([]string, []string, error) {
+	ids, err := s.client.SMembers(s.ctx, indexKey).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = sessionKey(id)
+	}
+	return ids, keys, nil
+}
+
+// scriptArgs - идентификаторы сессий как ARGV скрипта
+func scriptArgs(ids []string) []interface{} {
+	argv := make([]interface{}, len(ids))
+	for i, id := range ids {
+		argv[i] = id
+	}
+	return argv
+}
+
+// UsersInfo возвращает информацию о пользователях через Lua скрипт
+func (s *RedisStore) UsersInfo() (map[string]interface{}, error) {
+	ids, keys, err := s.indexedSessions(allSessionsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lua скрипт для получения всех сессий и преобразования в информацию о пользователях
+	keys = append([]string{allSessionsKey}, keys...)
+	result, err := usersInfoScript.Run(s.ctx, s.client, keys, scriptArgs(ids)...).Result()
 	if err != nil {
 		return nil, fmt.Errorf("Lua script execution failed: %v", err)
 	}
 
 	// Парсим результат
 	var sessions []map[string]interface{}
-	if resultStr, ok := result.(string); ok {
+	// cjson кодирует пустую таблицу как объект "{}"
+	if resultStr, ok := result.(string); ok && resultStr != "{}" {
 		if err := json.Unmarshal([]byte(resultStr), &sessions); err != nil {
 			return nil, fmt.Errorf("failed to parse Lua script result: %v", err)
 		}
@@ -52,36 +168,14 @@ func (m *Manager) GetUsersInfo() (map[string]interface{}, error) {
 	return response, nil
 }
 
-// GetSessionStats возвращает статистику по сессиям через Lua
-func (m *Manager) GetSessionStats() (map[string]interface{}, error) {
-	luaScript := `
-		local keys = redis.call('KEYS', 'session:*')
-		local total = #keys
-		local moderators = 0
-		local regular_users = 0
-		
-		for i, key in ipairs(keys) do
-			local sessionData = redis.call('GET', key)
-			if sessionData then
-				local session = cjson.decode(sessionData)
-				if session.is_moderator then
-					moderators = moderators + 1
-				else
-					regular_users = regular_users + 1
-				end
-			end
-		end
-		
-		local result = {
-			total_sessions = total,
-			moderators = moderators,
-			regular_users = regular_users
-		}
-		
-		return cjson.encode(result)
-	`
+// Stats возвращает статистику по сессиям через Lua
+func (s *RedisStore) Stats() (map[string]interface{}, error) {
+	_, keys, err := s.indexedSessions(allSessionsKey)
+	if err != nil {
+		return nil, err
+	}
 
-	result, err := m.client.Eval(m.ctx, luaScript, []string{}).Result()
+	result, err := statsScript.Run(s.ctx, s.client, keys).Result()
 	if err != nil {
 		return nil, fmt.Errorf("Lua script execution failed: %v", err)
 	}
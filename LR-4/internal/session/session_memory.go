@@ -0,0 +1,222 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore - хранилище сессий в памяти процесса с учетом TTL.
+// Подходит для локальной разработки и тестов обработчиков.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]memoryEntry
+	byClient map[uint]map[string]struct{}
+	now      func() time.Time
+}
+
+type memoryEntry struct {
+	session   Session
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]memoryEntry),
+		byClient: make(map[uint]map[string]struct{}),
+		now:      time.Now,
+	}
+}
+
+// lookup возвращает живую запись, удаляя истекшую (вызывается под mu)
+func (s *MemoryStore) lookup(id string) (memoryEntry, bool) {
+	entry, ok := s.sessions[id]
+	if !ok {
+		return memoryEntry{}, false
+	}
+
+	if !s.now().Before(entry.expiresAt) {
+		s.remove(id)
+		return memoryEntry{}, false
+	}
+
+	return entry, true
+}
+
+// remove удаляет сессию и ее запись в индексе клиента (вызывается под mu)
+func (s *MemoryStore) remove(id string) bool {
+	entry, ok := s.sessions[id]
+	if !ok {
+		return false
+	}
+
+	delete(s.sessions, id)
+	if ids := s.byClient[entry.session.ClientID]; ids != nil {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(s.byClient, entry.session.ClientID)
+		}
+	}
+
+	return true
+}
+
+func (s *MemoryStore) Create(id string, session Session, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(id)
+	s.sessions[id] = memoryEntry{session: session, expiresAt: s.now().Add(expiration)}
+
+	if s.byClient[session.ClientID] == nil {
+		s.byClient[session.ClientID] = make(map[string]struct{})
+	}
+	s.byClient[session.ClientID][id] = struct{}{}
+
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.lookup(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	session := entry.session
+	return &session, nil
+}
+
+func (s *MemoryStore) Touch(id string, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.lookup(id)
+	if !ok {
+		return ErrNotFound
+	}
+
+	entry.session = session
+	s.sessions[id] = entry
+	return nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(id)
+	return nil
+}
+
+func (s *MemoryStore) DeleteClient(clientID uint) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for id := range s.byClient[clientID] {
+		if _, ok := s.lookup(id); ok {
+			deleted++
+		}
+		s.remove(id)
+	}
+
+	return deleted, nil
+}
+
+func (s *MemoryStore) ClientSessions(clientID uint) (map[string]Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make(map[string]Session)
+	for id := range s.byClient[clientID] {
+		if entry, ok := s.lookup(id); ok {
+			sessions[id] = entry.session
+		}
+	}
+
+	return sessions, nil
+}
+
+func (s *MemoryStore) AllSessions() (map[string]Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make(map[string]Session)
+	for id := range s.sessions {
+		if entry, ok := s.lookup(id); ok {
+			sessions[id] = entry.session
+		}
+	}
+
+	return sessions, nil
+}
+
+func (s *MemoryStore) ClientOwns(clientID uint, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.byClient[clientID][id]; !ok {
+		return false, nil
+	}
+	_, ok := s.lookup(id)
+	return ok, nil
+}
+
+// UsersInfo возвращает то же, что и Lua-скрипт Redis-хранилища
+func (s *MemoryStore) UsersInfo() (map[string]interface{}, error) {
+	sessions, err := s.AllSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	users := []map[string]interface{}{}
+	for id, session := range sessions {
+		users = append(users, map[string]interface{}{
+			"session_id":   id,
+			"client_id":    session.ClientID,
+			"username":     session.Username,
+			"is_moderator": session.IsModerator,
+			"created_at":   session.CreatedAt,
+			"last_seen":    session.LastSeen,
+			"user_agent":   session.UserAgent,
+			"ip":           session.IP,
+		})
+	}
+
+	return map[string]interface{}{
+		"total_sessions": len(users),
+		"users":          users,
+	}, nil
+}
+
+// Stats возвращает то же, что и Lua-скрипт Redis-хранилища
+func (s *MemoryStore) Stats() (map[string]interface{}, error) {
+	sessions, err := s.AllSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	moderators := 0
+	for _, session := range sessions {
+		if session.IsModerator {
+			moderators++
+		}
+	}
+
+	return map[string]interface{}{
+		"total_sessions": len(sessions),
+		"moderators":     moderators,
+		"regular_users":  len(sessions) - moderators,
+	}, nil
+}
+
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
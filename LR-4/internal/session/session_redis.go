@@ -0,0 +1,187 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"smartdevices/internal/config"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/net/context"
+)
+
+// Ключи Redis:
+//
+//	session:<id>            - данные сессии
+//	client_sessions:<id>    - множество идентификаторов сессий клиента
+//	sessions:all            - множество идентификаторов всех сессий (вместо KEYS session:*)
+const allSessionsKey = "sessions:all"
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+func clientSessionsKey(clientID uint) string {
+	return fmt.Sprintf("client_sessions:%d", clientID)
+}
+
+// RedisStore - хранилище сессий в Redis
+type RedisStore struct {
+	client *redis.Client
+	ctx    context.Context
+}
+
+func NewRedisStore(cfg config.RedisConfig) *RedisStore {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx := context.Background()
+
+	// Проверяем подключение
+	_, err := client.Ping(ctx).Result()
+	if err != nil {
+		fmt.Printf("⚠️ Redis connection failed: %v\n", err)
+	} else {
+		fmt.Printf("✅ Redis client initialized successfully\n")
+	}
+
+	return &RedisStore{
+		client: client,
+		ctx:    ctx,
+	}
+}
+
+// Create сохраняет сессию и добавляет ее в индексы (атомарно, через Lua)
+func (s *RedisStore) Create(id string, session Session, expiration time.Duration) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{sessionKey(id), clientSessionsKey(session.ClientID), allSessionsKey}
+	return createSessionScript.Run(s.ctx, s.client, keys, data, expiration.Milliseconds(), id).Err()
+}
+
+func (s *RedisStore) Get(id string) (*Session, error) {
+	data, err := s.client.Get(s.ctx, sessionKey(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	err = json.Unmarshal([]byte(data), &session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (s *RedisStore) Touch(id string, session Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	err = s.client.SetArgs(s.ctx, sessionKey(id), data, redis.SetArgs{KeepTTL: true, Mode: "XX"}).Err()
+	if errors.Is(err, redis.Nil) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *RedisStore) Delete(id string) error {
+	keys := []string{sessionKey(id), allSessionsKey}
+
+	// Индекс клиента известен только из данных сессии; истекшая сессия
+	// останется в нем до очистки в loadSessions
+	session, err := s.Get(id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if session != nil {
+		keys = append(keys, clientSessionsKey(session.ClientID))
+	}
+
+	return deleteSessionScript.Run(s.ctx, s.client, keys, id).Err()
+}
+
+// DeleteClient удаляет сессии клиента, известные на момент вызова. Сессия, созданная
+// одновременно с удалением, уже получила новые данные клиента из БД.
+func (s *RedisStore) DeleteClient(clientID uint) (int, error) {
+	indexKey := clientSessionsKey(clientID)
+	ids, keys, err := s.indexedSessions(indexKey)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	keys = append([]string{indexKey, allSessionsKey}, keys...)
+	return deleteClientSessionsScript.Run(s.ctx, s.client, keys, scriptArgs(ids)...).Int()
+}
+
+func (s *RedisStore) ClientSessions(clientID uint) (map[string]Session, error) {
+	return s.loadSessions(clientSessionsKey(clientID))
+}
+
+func (s *RedisStore) AllSessions() (map[string]Session, error) {
+	return s.loadSessions(allSessionsKey)
+}
+
+// loadSessions читает сессии из индекса, убирая из него истекшие
+func (s *RedisStore) loadSessions(indexKey string) (map[string]Session, error) {
+	ids, err := s.client.SMembers(s.ctx, indexKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make(map[string]Session)
+	if len(ids) == 0 {
+		return sessions, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = sessionKey(id)
+	}
+
+	values, err := s.client.MGet(s.ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			// Сессия истекла по TTL - чистим индекс
+			s.client.SRem(s.ctx, indexKey, ids[i])
+			continue
+		}
+
+		var session Session
+		if json.Unmarshal([]byte(data), &session) == nil {
+			sessions[ids[i]] = session
+		}
+	}
+
+	return sessions, nil
+}
+
+func (s *RedisStore) ClientOwns(clientID uint, id string) (bool, error) {
+	return s.client.SIsMember(s.ctx, clientSessionsKey(clientID), id).Result()
+}
+
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
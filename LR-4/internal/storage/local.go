@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"smartdevices/internal/config"
+)
+
+// LocalStore - файлы в каталоге на диске. Раздает их само приложение (Handler),
+// поэтому для разработки и интеграционных тестов MinIO не нужен.
+// Content-Type определяется по расширению ключа.
+type LocalStore struct {
+	dir       string
+	publicURL string // без завершающего "/"
+	mountPath string // путь маршрута, например "/uploads/"
+}
+
+func NewLocalStore(cfg config.LocalStorageConfig) (*LocalStore, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("local storage: %w", err)
+	}
+
+	u, err := url.Parse(cfg.PublicURL)
+	if err != nil {
+		return nil, fmt.Errorf("local storage public url: %w", err)
+	}
+
+	log.Printf("✅ Local storage initialized - %s", cfg.Dir)
+	return &LocalStore{
+		dir:       cfg.Dir,
+		publicURL: strings.TrimSuffix(cfg.PublicURL, "/"),
+		mountPath: "/" + strings.Trim(u.Path, "/") + "/",
+	}, nil
+}
+
+// path возвращает путь к файлу объекта, не выходящий за пределы каталога
+func (s *LocalStore) path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// Пишем во временный файл и переименовываем, чтобы читатели не видели недописанный объект
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("failed to upload file: got %d bytes, want %d", written, size)
+	}
+
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+
+	log.Printf("✅ File saved to local storage: %s (%d bytes)", key, written)
+	return nil
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, ObjectInfo{}, mapFSError(err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, ObjectInfo{}, err
+	}
+	return f, fileInfo(key, fi), nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	log.Printf("✅ File deleted from local storage: %s", key)
+	return nil
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		return ObjectInfo{}, mapFSError(err)
+	}
+	return fileInfo(key, fi), nil
+}
+
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(s.dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, fileInfo(key, fi))
+		return nil
+	})
+	return objects, err
+}
+
+func (s *LocalStore) URL(key string) string {
+	return s.publicURL + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+// Key возвращает ключ объекта, если URL указывает на это хранилище
+func (s *LocalStore) Key(fileURL string) (string, bool) {
+	rest, ok := strings.CutPrefix(fileURL, s.publicURL+"/")
+	if !ok {
+		return "", false
+	}
+	key, err := url.PathUnescape(rest)
+	if err != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// Ping проверяет, что каталог доступен
+func (s *LocalStore) Ping(ctx context.Context) error {
+	_, err := os.Stat(s.dir)
+	return err
+}
+
+func (s *LocalStore) Close() error {
+	return nil
+}
+
+// MountPath - маршрут, по которому Handler раздает файлы
+func (s *LocalStore) MountPath() string {
+	return s.mountPath
+}
+
+// Handler раздает файлы хранилища (без листинга каталогов)
+func (s *LocalStore) Handler() http.Handler {
+	return http.StripPrefix(s.mountPath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, err := s.path(r.URL.Path)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		fi, err := os.Stat(name)
+		if err != nil || fi.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// Файл, открытый напрямую (SVG), не выполняет скрипты и ничего не подгружает
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+		http.ServeFile(w, r, name)
+	}))
+}
+
+func fileInfo(key string, fi fs.FileInfo) ObjectInfo {
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         fi.Size(),
+		ContentType:  contentType,
+		LastModified: fi.ModTime(),
+	}
+}
+
+func mapFSError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return err
+}
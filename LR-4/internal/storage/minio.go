@@ -1,83 +1,181 @@
 package storage
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"strings"
+
+	"smartdevices/internal/config"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
-type MinIOClient struct {
-	client *minio.Client
-	bucket string
+// MinIOStore - хранилище в bucket MinIO (S3)
+type MinIOStore struct {
+	client    *minio.Client
+	transport *http.Transport
+	bucket    string
+	publicURL string
 }
 
-func NewMinIOClient() *MinIOClient {
-	// Создаем клиент MinIO
-	minioClient, err := minio.New("minio:9000", &minio.Options{
-		Creds:  credentials.NewStaticV4("myaccesskey123", "mysecretkey123456", ""),
-		Secure: false,
+// NewMinIOStore создает клиент MinIO. Недоступный сервер или отсутствующий bucket
+// не мешают старту - это видно в /readyz; ошибка настроек клиента возвращается.
+func NewMinIOStore(cfg config.MinIOConfig) (*MinIOStore, error) {
+	// Свой транспорт, чтобы закрыть соединения при остановке
+	transport, err := minio.DefaultTransport(cfg.UseSSL)
+	if err != nil {
+		return nil, fmt.Errorf("minio transport: %w", err)
+	}
+
+	minioClient, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:    cfg.UseSSL,
+		Transport: transport,
 	})
 	if err != nil {
-		log.Printf("⚠️ Failed to create MinIO client: %v", err)
-		return &MinIOClient{}
+		return nil, fmt.Errorf("minio client: %w", err)
 	}
 
 	// Проверяем подключение и существование bucket
-	exists, err := minioClient.BucketExists(context.Background(), "image")
+	exists, err := minioClient.BucketExists(context.Background(), cfg.Bucket)
 	if err != nil {
 		log.Printf("⚠️ MinIO connection failed: %v", err)
 	} else if exists {
-		log.Printf("✅ MinIO client initialized - bucket 'image' exists")
+		log.Printf("✅ MinIO client initialized - bucket '%s' exists", cfg.Bucket)
 	} else {
-		log.Printf("❌ MinIO bucket 'image' not found - please create manually")
+		log.Printf("❌ MinIO bucket '%s' not found - please create manually", cfg.Bucket)
+	}
+
+	return &MinIOStore{
+		client:    minioClient,
+		transport: transport,
+		bucket:    cfg.Bucket,
+		publicURL: strings.TrimSuffix(cfg.PublicURL, "/"),
+	}, nil
+}
+
+// streamPartSize - размер части multipart-загрузки объекта неизвестного размера.
+// Без него minio-go рассчитывает часть на объект в 5 ТиБ и выделяет буфер ~550 МБ
+// на каждую загрузку; 8 МиБ хватает картинке целиком, большие файлы идут по частям.
+const streamPartSize = 8 << 20
+
+func (m *MinIOStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if _, err := cleanKey(key); err != nil {
+		return err
 	}
 
-	return &MinIOClient{
-		client: minioClient,
-		bucket: "image",
+	opts := minio.PutObjectOptions{
+		ContentType: contentType,
 	}
+	if size < 0 {
+		opts.PartSize = streamPartSize
+	}
+	// MinIO раздает объект со своими заголовками: SVG, открытый напрямую, скачивается,
+	// а не выполняется как документ с origin хранилища (в <img> он показывается как обычно)
+	if contentType == "image/svg+xml" {
+		opts.ContentDisposition = "attachment"
+	}
+
+	info, err := m.client.PutObject(ctx, m.bucket, key, r, size, opts)
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	log.Printf("✅ File uploaded to MinIO: %s (%d bytes)", key, info.Size)
+	return nil
 }
 
-func (m *MinIOClient) UploadFile(filename string, fileData []byte) error {
-	if m.client == nil {
-		return fmt.Errorf("MinIO client not initialized")
+func (m *MinIOStore) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	obj, err := m.client.GetObject(ctx, m.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, ObjectInfo{}, mapError(err)
 	}
 
-	// Просто загружаем файл (bucket должен быть создан заранее)
-	_, err := m.client.PutObject(context.Background(), m.bucket, filename,
-		bytes.NewReader(fileData), int64(len(fileData)),
-		minio.PutObjectOptions{
-			ContentType: "image/png",
-		})
+	// GetObject ленивый: отсутствие объекта видно только после Stat
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, ObjectInfo{}, mapError(err)
+	}
+	return obj, objectInfo(stat), nil
+}
 
+func (m *MinIOStore) Delete(ctx context.Context, key string) error {
+	err := m.client.RemoveObject(ctx, m.bucket, key, minio.RemoveObjectOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to upload file: %v", err)
+		return fmt.Errorf("failed to delete file: %w", err)
 	}
 
-	log.Printf("✅ File uploaded to MinIO: %s (%d bytes)", filename, len(fileData))
+	log.Printf("✅ File deleted from MinIO: %s", key)
 	return nil
 }
 
-func (m *MinIOClient) DeleteFile(filename string) error {
-	if m.client == nil {
-		return fmt.Errorf("MinIO client not initialized")
+func (m *MinIOStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	stat, err := m.client.StatObject(ctx, m.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, mapError(err)
 	}
+	return objectInfo(stat), nil
+}
+
+func (m *MinIOStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for obj := range m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, objectInfo(obj))
+	}
+	return objects, nil
+}
+
+func (m *MinIOStore) URL(key string) string {
+	return fmt.Sprintf("%s/%s/%s", m.publicURL, m.bucket, key)
+}
 
-	err := m.client.RemoveObject(context.Background(), m.bucket, filename,
-		minio.RemoveObjectOptions{})
+// Key возвращает имя объекта, если URL указывает на наш bucket
+func (m *MinIOStore) Key(imageURL string) (string, bool) {
+	prefix := fmt.Sprintf("%s/%s/", m.publicURL, m.bucket)
+	if m.publicURL == "" || !strings.HasPrefix(imageURL, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(imageURL, prefix), true
+}
 
+// Ping проверяет, что MinIO доступен и bucket существует
+func (m *MinIOStore) Ping(ctx context.Context) error {
+	exists, err := m.client.BucketExists(ctx, m.bucket)
 	if err != nil {
-		return fmt.Errorf("failed to delete file: %v", err)
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket %q not found", m.bucket)
 	}
+	return nil
+}
 
-	log.Printf("✅ File deleted from MinIO: %s", filename)
+// Close закрывает простаивающие соединения с MinIO
+func (m *MinIOStore) Close() error {
+	m.transport.CloseIdleConnections()
 	return nil
 }
 
-func (m *MinIOClient) GetImageURL(filename string) string {
-	return fmt.Sprintf("http://localhost:9000/%s/%s", m.bucket, filename)
+func objectInfo(obj minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          obj.Key,
+		Size:         obj.Size,
+		ContentType:  obj.ContentType,
+		LastModified: obj.LastModified,
+	}
+}
+
+func mapError(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return err
 }
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"smartdevices/internal/config"
+)
+
+// ErrNotFound - объекта с таким ключом нет
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo - сведения об объекте
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// ObjectStore - хранилище загруженных файлов. Ключ - путь внутри хранилища
+// ("device_1_1700000000.png"), URL - адрес, по которому файл доступен браузеру.
+type ObjectStore interface {
+	// Put сохраняет объект; size = -1, если размер заранее неизвестен
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	// Delete не считает ошибкой отсутствие объекта
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	URL(key string) string
+	// Key возвращает ключ объекта, если URL указывает на это хранилище
+	Key(url string) (string, bool)
+
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// New создает хранилище, выбранное в storage.backend
+func New(cfg config.Config) (ObjectStore, error) {
+	switch cfg.Storage.Backend {
+	case "minio":
+		return NewMinIOStore(cfg.MinIO)
+	case "local":
+		return NewLocalStore(cfg.Storage.Local)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}
+
+// cleanKey отклоняет ключи, выходящие за пределы хранилища ("../x", "/etc/x")
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != key || strings.HasPrefix(key, "/") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,186 @@
+package traffic
+
+import (
+	"smartdevices/internal/devicetype"
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Item - позиция заявки для расчета
+type Item struct {
+	Device   models.SmartDevice // с загруженным DeviceType
+	Quantity int
+}
+
+// Line - расчет одной позиции: Result = Base × Coefficient, Base = DataPerHour × Quantity
+type Line struct {
+	DeviceID    uint    `json:"device_id"`
+	DeviceName  string  `json:"device_name"`
+	DeviceType  string  `json:"device_type,omitempty"`
+	Quantity    int     `json:"quantity"`
+	DataPerHour float64 `json:"data_per_hour"`
+	AvgDataRate float64 `json:"avg_data_rate"`
+	Base        float64 `json:"base"`
+	Coefficient float64 `json:"coefficient"`
+	Result      float64 `json:"result"`
+}
+
+// Breakdown - общий трафик заявки (Кб/ч) с расшифровкой по позициям
+type Breakdown struct {
+	Method string  `json:"method"`
+	Items  []Line  `json:"items"`
+	Total  float64 `json:"total"`
+}
+
+// Calculator - алгоритм расчета трафика. Корзина, API и завершение заявки
+// используют один и тот же Calculator, поэтому итоги всегда совпадают.
+type Calculator interface {
+	Calculate(items []Item) Breakdown
+}
+
+// MethodRecorded - расшифровка сохранена при завершении заявки
+const MethodRecorded = "recorded"
+
+// CoefficientCalculator - базовый трафик устройства умножается на коэффициент его типа
+type CoefficientCalculator struct{}
+
+func (CoefficientCalculator) Calculate(items []Item) Breakdown {
+	b := Breakdown{Method: "coefficient", Items: []Line{}}
+	for _, item := range items {
+		line := newLine(item.Device, item.Quantity)
+		line.Coefficient = devicetype.Coefficient(item.Device)
+		line.Result = line.Base * line.Coefficient
+
+		b.Items = append(b.Items, line)
+		b.Total += line.Result
+	}
+	return b
+}
+
+func newLine(device models.SmartDevice, quantity int) Line {
+	line := Line{
+		DeviceID:    device.ID,
+		DeviceName:  device.Name,
+		Quantity:    quantity,
+		DataPerHour: device.DataPerHour,
+		AvgDataRate: device.AvgDataRate,
+		Base:        device.DataPerHour * float64(quantity),
+	}
+	if device.DeviceType != nil {
+		line.DeviceType = device.DeviceType.Code
+	}
+	return line
+}
+
+// LoadItems загружает позиции заявки вместе с устройствами и их типами
+func LoadItems(db *gorm.DB, orderID uint) ([]models.OrderItem, error) {
+	var items []models.OrderItem
+	err := db.Preload("Device.DeviceType").
+		Where("order_id = ?", orderID).
+		Order("device_id").
+		Find(&items).Error
+	return items, err
+}
+
+// ItemsOf превращает позиции заявки во входные данные калькулятора
+func ItemsOf(orderItems []models.OrderItem) []Item {
+	items := make([]Item, 0, len(orderItems))
+	for _, oi := range orderItems {
+		items = append(items, Item{Device: oi.Device, Quantity: oi.Quantity})
+	}
+	return items
+}
+
+// Record сохраняет в позициях коэффициент и результат расчета,
+// чтобы расшифровка завершенной заявки не менялась вместе с типами устройств
+func Record(orderItems []models.OrderItem, b Breakdown) {
+	results := make(map[uint]Line, len(b.Items))
+	for _, line := range b.Items {
+		results[line.DeviceID] = line
+	}
+
+	for i := range orderItems {
+		if line, ok := results[orderItems[i].DeviceID]; ok {
+			orderItems[i].TrafficCoefficient = &line.Coefficient
+			orderItems[i].Traffic = &line.Result
+		}
+	}
+}
+
+// ForOrder - расшифровка трафика заявки: для завершенной - сохраненная при завершении,
+// для остальных - текущий расчет.
+func ForOrder(calc Calculator, order models.SmartOrder, orderItems []models.OrderItem) Breakdown {
+	if order.Status == "completed" {
+		if b, ok := recorded(orderItems); ok {
+			return b
+		}
+	}
+	return calc.Calculate(ItemsOf(orderItems))
+}
+
+// recorded собирает расшифровку из сохраненных значений (если они есть у всех позиций)
+func recorded(orderItems []models.OrderItem) (Breakdown, bool) {
+	b := Breakdown{Method: MethodRecorded, Items: []Line{}}
+	for _, oi := range orderItems {
+		if oi.TrafficCoefficient == nil || oi.Traffic == nil {
+			return Breakdown{}, false
+		}
+
+		// Базу восстанавливаем из сохраненных значений: трафик устройства мог измениться
+		line := newLine(oi.Device, oi.Quantity)
+		line.Coefficient = *oi.TrafficCoefficient
+		line.Result = *oi.Traffic
+		if line.Coefficient != 0 && oi.Quantity > 0 {
+			line.Base = line.Result / line.Coefficient
+			line.DataPerHour = line.Base / float64(oi.Quantity)
+		}
+
+		b.Items = append(b.Items, line)
+		b.Total += line.Result
+	}
+	return b, len(orderItems) > 0
+}
+
+// HoursPerMonth - месяц для прогноза считаем как 30 дней
+const HoursPerMonth = 30 * 24
+
+// Volume - объем трафика в разных единицах (1 MB = 1024 Kb, 1 GB = 1024 MB)
+type Volume struct {
+	KB float64 `json:"kb"`
+	MB float64 `json:"mb"`
+	GB float64 `json:"gb"`
+}
+
+func volumeOf(kb float64) Volume {
+	return Volume{KB: kb, MB: kb / 1024, GB: kb / 1024 / 1024}
+}
+
+// Estimate - прогноз нагрузки на интернет-канал по расшифровке трафика.
+// Средняя скорость - суточный объем, размазанный по времени; пиковая - если все
+// устройства передают данные одновременно со своей AvgDataRate.
+type Estimate struct {
+	Hourly        Volume  `json:"hourly"`
+	Daily         Volume  `json:"daily"`
+	Monthly       Volume  `json:"monthly"`
+	AverageRate   float64 `json:"average_rate"` // Кб/с
+	PeakRate      float64 `json:"peak_rate"`    // Кб/с
+	PeakToAverage float64 `json:"peak_to_average,omitempty"`
+}
+
+// EstimateOf строит прогноз по расшифровке
+func EstimateOf(b Breakdown) Estimate {
+	e := Estimate{
+		Hourly:      volumeOf(b.Total),
+		Daily:       volumeOf(b.Total * 24),
+		Monthly:     volumeOf(b.Total * HoursPerMonth),
+		AverageRate: b.Total / 3600,
+	}
+	for _, line := range b.Items {
+		e.PeakRate += line.AvgDataRate * float64(line.Quantity)
+	}
+	if e.AverageRate > 0 {
+		e.PeakToAverage = e.PeakRate / e.AverageRate
+	}
+	return e
+}
@@ -0,0 +1,66 @@
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"smartdevices/internal/apperr"
+)
+
+// MaxBodyBytes - предельный размер JSON-тела запроса
+const MaxBodyBytes = 1 << 20 // 1 MB
+
+// CodeBodyTooLarge - тело запроса превышает MaxBodyBytes
+const CodeBodyTooLarge apperr.Code = "body_too_large"
+
+// DecodeJSON читает тело запроса в dst и проверяет его по тегам validate.
+// Неизвестные поля, лишние данные после JSON и слишком большое тело - ошибка.
+// Пустое тело возвращает ошибку, оборачивающую io.EOF.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	if dec.More() {
+		return apperr.BadRequest("Request body must contain a single JSON object")
+	}
+
+	if errs := Struct(dst); len(errs) > 0 {
+		return apperr.Validation(errs...)
+	}
+	return nil
+}
+
+func decodeError(err error) error {
+	var (
+		maxBytes *http.MaxBytesError
+		typeErr  *json.UnmarshalTypeError
+	)
+
+	switch {
+	case errors.As(err, &maxBytes):
+		return apperr.New(http.StatusRequestEntityTooLarge, CodeBodyTooLarge,
+			fmt.Sprintf("Request body must not exceed %d bytes", maxBytes.Limit)).Wrap(err)
+	case errors.As(err, &typeErr):
+		e := apperr.InvalidBody(err)
+		// Для полей со своим UnmarshalJSON encoding/json имя поля не сообщает
+		if typeErr.Field != "" {
+			e.Fields = []apperr.FieldError{{Field: typeErr.Field, Code: "type", Message: typeErr.Field + " must be " + typeErr.Type.String()}}
+		}
+		return e
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json не экспортирует тип для этой ошибки
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		e := apperr.InvalidBody(err)
+		e.Fields = []apperr.FieldError{{Field: field, Code: "unknown", Message: "Unknown field " + field}}
+		return e
+	default:
+		return apperr.InvalidBody(err)
+	}
+}
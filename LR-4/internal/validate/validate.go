@@ -0,0 +1,168 @@
+package validate
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"smartdevices/internal/apperr"
+)
+
+// Struct проверяет поля структуры по тегу `validate` и возвращает все ошибки разом.
+//
+// Правила (через запятую):
+//
+//	required     - значение задано (строка не пустая после TrimSpace)
+//	omitempty    - пустое значение не проверяется остальными правилами
+//	min=N, max=N - для строк длина в символах, для чисел значение, для срезов длина
+//	len=N        - точная длина строки или среза
+//	maxbytes=N   - длина строки в байтах UTF-8 (пароли: bcrypt учитывает 72 байта)
+//	oneof=a b c  - одно из перечисленных значений
+//	url          - абсолютный http(s) URL
+//
+// Имя поля в ошибке берется из тега json.
+func Struct(v any) []apperr.FieldError {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs []apperr.FieldError
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || !field.IsExported() {
+			continue
+		}
+
+		if fe, ok := checkField(jsonName(field), rv.Field(i), tag); !ok {
+			errs = append(errs, fe)
+		}
+	}
+	return errs
+}
+
+// checkField возвращает первую нарушенную проверку поля
+func checkField(name string, value reflect.Value, tag string) (apperr.FieldError, bool) {
+	rules := strings.Split(tag, ",")
+
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			if slices.Contains(rules, "required") {
+				return required(name), false
+			}
+			return apperr.FieldError{}, true
+		}
+		value = value.Elem()
+	}
+
+	if isEmpty(value) {
+		if slices.Contains(rules, "required") {
+			return required(name), false
+		}
+		if slices.Contains(rules, "omitempty") {
+			return apperr.FieldError{}, true
+		}
+	}
+
+	for _, rule := range rules {
+		key, arg, _ := strings.Cut(rule, "=")
+		switch key {
+		case "required", "omitempty":
+		case "min", "max", "len":
+			if fe, ok := checkBound(name, key, arg, value); !ok {
+				return fe, false
+			}
+		case "maxbytes":
+			limit, err := strconv.Atoi(arg)
+			if err != nil {
+				panic(fmt.Sprintf("validate: bad maxbytes=%q on field %s", arg, name))
+			}
+			if len(value.String()) > limit {
+				return apperr.FieldError{Field: name, Code: "max", Message: fmt.Sprintf("%s must be at most %d bytes", name, limit)}, false
+			}
+		case "oneof":
+			options := strings.Fields(arg)
+			if !slices.Contains(options, fmt.Sprint(value.Interface())) {
+				return apperr.FieldError{
+					Field:   name,
+					Code:    "oneof",
+					Message: fmt.Sprintf("%s must be one of: %s", name, strings.Join(options, ", ")),
+				}, false
+			}
+		case "url":
+			if u, err := url.Parse(value.String()); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return apperr.FieldError{Field: name, Code: "url", Message: name + " must be an absolute http(s) URL"}, false
+			}
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q on field %s", key, name))
+		}
+	}
+	return apperr.FieldError{}, true
+}
+
+func checkBound(name, key, arg string, value reflect.Value) (apperr.FieldError, bool) {
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validate: bad %s=%q on field %s", key, arg, name))
+	}
+
+	var actual float64
+	unit := ""
+	switch value.Kind() {
+	case reflect.String:
+		actual = float64(utf8.RuneCountInString(value.String()))
+		unit = " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		actual = float64(value.Len())
+		unit = " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		actual = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		actual = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		actual = value.Float()
+	default:
+		panic(fmt.Sprintf("validate: %s is not supported for %s", key, value.Kind()))
+	}
+
+	switch {
+	case key == "min" && actual < limit:
+		if unit == "" {
+			return apperr.FieldError{Field: name, Code: "min", Message: fmt.Sprintf("%s must be at least %s", name, arg)}, false
+		}
+		return apperr.FieldError{Field: name, Code: "min", Message: fmt.Sprintf("%s must contain at least %s%s", name, arg, unit)}, false
+	case key == "max" && actual > limit:
+		if unit == "" {
+			return apperr.FieldError{Field: name, Code: "max", Message: fmt.Sprintf("%s must be at most %s", name, arg)}, false
+		}
+		return apperr.FieldError{Field: name, Code: "max", Message: fmt.Sprintf("%s must contain at most %s%s", name, arg, unit)}, false
+	case key == "len" && actual != limit:
+		return apperr.FieldError{Field: name, Code: "len", Message: fmt.Sprintf("%s must contain exactly %s%s", name, arg, unit)}, false
+	}
+	return apperr.FieldError{}, true
+}
+
+func required(name string) apperr.FieldError {
+	return apperr.FieldError{Field: name, Code: "required", Message: name + " is required"}
+}
+
+func isEmpty(v reflect.Value) bool {
+	if v.Kind() == reflect.String {
+		return strings.TrimSpace(v.String()) == ""
+	}
+	return v.IsZero()
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
@@ -1,7 +1,7 @@
 import React from 'react';
 import { Link } from 'react-router-dom';
 import { Card, Button, Badge } from 'react-bootstrap';
-import type { SmartDevice } from '../../types';
+import { imageSrcSet, type SmartDevice } from '../../types';
 
 interface DeviceCardProps {
   device: SmartDevice;
@@ -27,6 +27,9 @@ const DeviceCard: React.FC<DeviceCardProps> = ({ device }) => {
         <Card.Img 
           variant="top" 
           src={device.namespace_url || getDefaultImage()}
+          srcSet={imageSrcSet(device)}
+          sizes="(max-width: 576px) 100vw, (max-width: 992px) 50vw, 25vw"
+          loading="lazy"
           alt={device.name}
           style={{ 
             height: '100%', 
@@ -35,6 +38,7 @@ const DeviceCard: React.FC<DeviceCardProps> = ({ device }) => {
           }}
           onError={(e) => {
             const target = e.target as HTMLImageElement;
+            target.removeAttribute('srcset');
             target.src = getDefaultImage();
           }}
         />
@@ -1,7 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { useParams } from 'react-router-dom';
 import { Container, Row, Col, Card, Spinner, Alert } from 'react-bootstrap';
-import type { SmartDevice } from '../types';
+import { imageSrcSet, type SmartDevice } from '../types';
 import { api } from '../services/api';
 
 const DeviceDetailPage: React.FC = () => {
@@ -62,9 +62,12 @@ const DeviceDetailPage: React.FC = () => {
             <Card.Img 
               variant="top" 
               src={device.namespace_url || getDefaultImage()}
+              srcSet={imageSrcSet(device)}
+              sizes="(max-width: 992px) 100vw, 50vw"
               alt={device.name}
               onError={(e) => {
                 const target = e.target as HTMLImageElement;
+                target.removeAttribute('srcset');
                 target.src = getDefaultImage();
               }}
             />
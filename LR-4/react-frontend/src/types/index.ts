@@ -10,8 +10,17 @@ export interface SmartDevice {
   protocol: string;
   is_active: boolean;
   created_at: string;
+  image_srcset?: Record<string, string>; // "160w" -> URL, включая оригинал
 }
 
+// srcset из image_srcset: "url 160w, url 480w, ..."
+export const imageSrcSet = (device: SmartDevice): string | undefined => {
+  if (!device.image_srcset) return undefined;
+  return Object.entries(device.image_srcset)
+    .map(([width, url]) => `${url} ${width}`)
+    .join(', ');
+};
+
 export interface SmartOrder {
   id: number;
   status: string;